@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zero-day-ai/sdk/toolerr"
+)
+
+// optionArg describes whether an nmap option takes an argument
+type optionArg int
+
+const (
+	noArg optionArg = iota
+	requiredArg
+	optionalArg // only ever attached: -d2, --debug=2
+)
+
+// longOption describes an nmap long option
+type longOption struct {
+	name string // canonical name, e.g. "--host-timeout" or "-oN"
+	arg  optionArg
+}
+
+// nmapLongOptions lists nmap's long options by spelling. nmap parses its command
+// line with getopt_long_only, so these are accepted with one or two dashes and
+// as unambiguous abbreviations. Most also have an underscore spelling, added in init.
+var nmapLongOptions = map[string]longOption{
+	// Target specification
+	"iL":          {"-iL", requiredArg},
+	"iR":          {"-iR", requiredArg},
+	"exclude":     {"--exclude", requiredArg},
+	"excludefile": {"--excludefile", requiredArg},
+
+	// Host discovery
+	"disable-arp-ping":     {"--disable-arp-ping", noArg},
+	"discovery-ignore-rst": {"--discovery-ignore-rst", noArg},
+	"traceroute":           {"--traceroute", noArg},
+	"dns-servers":          {"--dns-servers", requiredArg},
+	"system-dns":           {"--system-dns", noArg},
+	"resolve-all":          {"--resolve-all", noArg},
+	"unique":               {"--unique", noArg},
+
+	// Scan techniques
+	"sI":        {"-sI", requiredArg},
+	"scanflags": {"--scanflags", requiredArg},
+
+	// Port specification
+	"exclude-ports": {"--exclude-ports", requiredArg},
+	"top-ports":     {"--top-ports", requiredArg},
+	"port-ratio":    {"--port-ratio", requiredArg},
+	"allports":      {"--allports", noArg},
+
+	// Service, version and OS detection
+	"version-intensity": {"--version-intensity", requiredArg},
+	"version-light":     {"--version-light", noArg},
+	"version-all":       {"--version-all", noArg},
+	"version-trace":     {"--version-trace", noArg},
+	"osscan-limit":      {"--osscan-limit", noArg},
+	"osscan-guess":      {"--osscan-guess", noArg},
+	"fuzzy":             {"--osscan-guess", noArg},
+	"max-os-tries":      {"--max-os-tries", requiredArg},
+
+	// Scripts
+	"script":           {"--script", requiredArg},
+	"script-args":      {"--script-args", requiredArg},
+	"script-args-file": {"--script-args-file", requiredArg},
+	"script-trace":     {"--script-trace", noArg},
+	"script-updatedb":  {"--script-updatedb", noArg},
+	"script-help":      {"--script-help", requiredArg},
+	"script-timeout":   {"--script-timeout", requiredArg},
+
+	// Timing and performance
+	"min-hostgroup":         {"--min-hostgroup", requiredArg},
+	"max-hostgroup":         {"--max-hostgroup", requiredArg},
+	"min-parallelism":       {"--min-parallelism", requiredArg},
+	"max-parallelism":       {"--max-parallelism", requiredArg},
+	"min-rtt-timeout":       {"--min-rtt-timeout", requiredArg},
+	"max-rtt-timeout":       {"--max-rtt-timeout", requiredArg},
+	"initial-rtt-timeout":   {"--initial-rtt-timeout", requiredArg},
+	"max-retries":           {"--max-retries", requiredArg},
+	"host-timeout":          {"--host-timeout", requiredArg},
+	"scan-delay":            {"--scan-delay", requiredArg},
+	"max-scan-delay":        {"--max-scan-delay", requiredArg},
+	"min-rate":              {"--min-rate", requiredArg},
+	"max-rate":              {"--max-rate", requiredArg},
+	"defeat-rst-ratelimit":  {"--defeat-rst-ratelimit", noArg},
+	"defeat-icmp-ratelimit": {"--defeat-icmp-ratelimit", noArg},
+	"nsock-engine":          {"--nsock-engine", requiredArg},
+
+	// Firewall/IDS evasion and spoofing
+	"mtu":         {"--mtu", requiredArg},
+	"ff":          {"-f", noArg},
+	"source-port": {"--source-port", requiredArg},
+	"proxies":     {"--proxies", requiredArg},
+	"proxy":       {"--proxies", requiredArg},
+	"data":        {"--data", requiredArg},
+	"data-string": {"--data-string", requiredArg},
+	"data-length": {"--data-length", requiredArg},
+	"ip-options":  {"--ip-options", requiredArg},
+	"ttl":         {"--ttl", requiredArg},
+	"spoof-mac":   {"--spoof-mac", requiredArg},
+	"badsum":      {"--badsum", noArg},
+	"adler32":     {"--adler32", noArg},
+
+	// Output
+	"oN":                     {"-oN", requiredArg},
+	"oX":                     {"-oX", requiredArg},
+	"oS":                     {"-oS", requiredArg},
+	"oG":                     {"-oG", requiredArg},
+	"oA":                     {"-oA", requiredArg},
+	"oM":                     {"-oM", requiredArg},
+	"oH":                     {"-oH", requiredArg},
+	"verbose":                {"-v", optionalArg},
+	"vv":                     {"-v", noArg},
+	"debug":                  {"-d", optionalArg},
+	"reason":                 {"--reason", noArg},
+	"stats-every":            {"--stats-every", requiredArg},
+	"packet-trace":           {"--packet-trace", noArg},
+	"open":                   {"--open", noArg},
+	"iflist":                 {"--iflist", noArg},
+	"append-output":          {"--append-output", noArg},
+	"resume":                 {"--resume", requiredArg},
+	"noninteractive":         {"--noninteractive", noArg},
+	"stylesheet":             {"--stylesheet", requiredArg},
+	"webxml":                 {"--webxml", noArg},
+	"no-stylesheet":          {"--no-stylesheet", noArg},
+	"log-errors":             {"--log-errors", noArg},
+	"deprecated-xml-osclass": {"--deprecated-xml-osclass", noArg},
+
+	// Misc
+	"randomize-hosts": {"--randomize-hosts", noArg},
+	"rH":              {"--randomize-hosts", noArg},
+	"datadir":         {"--datadir", requiredArg},
+	"servicedb":       {"--servicedb", requiredArg},
+	"versiondb":       {"--versiondb", requiredArg},
+	"send-eth":        {"--send-eth", noArg},
+	"send-ip":         {"--send-ip", noArg},
+	"privileged":      {"--privileged", noArg},
+	"unprivileged":    {"--unprivileged", noArg},
+	"release-memory":  {"--release-memory", noArg},
+	"route-dst":       {"--route-dst", requiredArg},
+	"thc":             {"--thc", noArg},
+	"version":         {"-V", noArg},
+	"help":            {"-h", noArg},
+}
+
+func init() {
+	// nmap accepts most long options with underscores as well as hyphens
+	for spelling, option := range nmapLongOptions {
+		if strings.Contains(spelling, "-") {
+			underscored := strings.ReplaceAll(spelling, "-", "_")
+			if _, exists := nmapLongOptions[underscored]; !exists {
+				nmapLongOptions[underscored] = option
+			}
+		}
+	}
+}
+
+// nmapShortOptions mirrors nmap's getopt string "46Ab:D:d::e:Ffg:hIi:M:m:nO::o:P:p:qRrS:s:T:Vv::"
+var nmapShortOptions = map[byte]optionArg{
+	'4': noArg, '6': noArg, 'A': noArg, 'F': noArg, 'f': noArg, 'h': noArg,
+	'I': noArg, 'n': noArg, 'q': noArg, 'R': noArg, 'r': noArg, 'V': noArg,
+	'b': requiredArg, 'D': requiredArg, 'e': requiredArg, 'g': requiredArg,
+	'i': requiredArg, 'M': requiredArg, 'm': requiredArg, 'o': requiredArg,
+	'P': requiredArg, 'p': requiredArg, 'S': requiredArg, 's': requiredArg,
+	'T': requiredArg,
+	'd': optionalArg, 'O': optionalArg, 'v': optionalArg,
+}
+
+// scanTechniques maps the letters of a -s argument to canonical scan flags.
+// Several may be combined in one argument, as in -sSV.
+var scanTechniques = map[byte]string{
+	'A': "-sA", 'C': "-sC", 'F': "-sF", 'I': "-sI", 'L': "-sL", 'M': "-sM",
+	'N': "-sN", 'O': "-sO", 'P': "-sn", 'R': "-sV", 'S': "-sS", 'T': "-sT",
+	'U': "-sU", 'V': "-sV", 'W': "-sW", 'X': "-sX", 'Y': "-sY", 'Z': "-sZ",
+	'n': "-sn",
+}
+
+// pingProbes maps the first letter of a -P argument to canonical host discovery
+// flags; the rest of the argument is the probe's port or protocol list
+var pingProbes = map[byte]string{
+	'S': "-PS", 'A': "-PA", 'U': "-PU", 'Y': "-PY", 'E': "-PE", 'P': "-PP",
+	'M': "-PM", 'O': "-PO", 'R': "-PR", 'n': "-Pn", 'N': "-Pn", '0': "-Pn",
+	'I': "-PE", 'T': "-PA",
+}
+
+// impliedOptions lists options that switch on others
+var impliedOptions = map[string][]string{
+	"-A": {"-O", "-sV", "-sC", "--traceroute"},
+}
+
+// nmapOption is a single option from an nmap command line in normalized form
+type nmapOption struct {
+	Name    string // canonical name, e.g. "-sS", "-PE", "--host-timeout"
+	Value   string // option argument, if any
+	Raw     string // the argument as the caller wrote it, e.g. "-sSV"
+	Implied bool   // switched on by another option, e.g. -O by -A
+}
+
+// String describes the option for error messages, including where it came from
+func (o nmapOption) String() string {
+	switch {
+	case o.Implied:
+		return fmt.Sprintf("'%s' (implied by '%s')", o.Name, o.Raw)
+	case o.Raw != o.Name && !strings.HasPrefix(o.Raw, o.Name+"="):
+		return fmt.Sprintf("'%s' (in '%s')", o.Name, o.Raw)
+	default:
+		return fmt.Sprintf("'%s'", o.Name)
+	}
+}
+
+// nmapArgs is a parsed nmap command line
+type nmapArgs struct {
+	Options []nmapOption
+	Targets []string // positional arguments
+}
+
+// has reports whether an option is present, given or implied
+func (a *nmapArgs) has(name string) bool {
+	for _, option := range a.Options {
+		if option.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns the arguments of every occurrence of an option
+func (a *nmapArgs) values(name string) []string {
+	var values []string
+	for _, option := range a.Options {
+		if option.Name == name && !option.Implied {
+			values = append(values, option.Value)
+		}
+	}
+	return values
+}
+
+// parseNmapArgs parses an nmap command line following nmap's own getopt_long_only
+// rules: long options with one or two dashes and unambiguous abbreviations,
+// clustered short options, and which options consume the next argument. Combined
+// scan types (-sSV) and ping probes (-PE) are split into canonical options and
+// options implied by -A are added.
+func parseNmapArgs(args []string) (*nmapArgs, error) {
+	parsed := &nmapArgs{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			parsed.Targets = append(parsed.Targets, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			parsed.Targets = append(parsed.Targets, arg)
+			continue
+		}
+
+		// Long options: always for "--", and for "-" unless the argument is a
+		// single short option letter such as -d
+		doubleDash := strings.HasPrefix(arg, "--")
+		if doubleDash || len(arg) > 2 || !isShortOption(arg[1]) {
+			body := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+			name, value, hasValue := strings.Cut(body, "=")
+
+			option, err := lookupLongOption(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			if option != nil {
+				switch {
+				case option.arg == noArg && hasValue:
+					return nil, fmt.Errorf("option %s does not take a value", arg)
+				case option.arg == requiredArg && !hasValue:
+					if i+1 >= len(args) {
+						return nil, fmt.Errorf("option %s requires a value", arg)
+					}
+					i++
+					value = args[i]
+				}
+				parsed.add(nmapOption{Name: option.name, Value: value, Raw: arg})
+				continue
+			}
+			if doubleDash || !isShortOption(arg[1]) {
+				return nil, fmt.Errorf("unrecognized option %s", arg)
+			}
+		}
+
+		// Short options, possibly clustered (-nF) or with an attached value (-p22)
+		consumed, err := parsed.parseShort(args, i)
+		if err != nil {
+			return nil, err
+		}
+		i += consumed
+	}
+
+	return parsed, nil
+}
+
+// parseScanArgs parses scan arguments for validation. Targets are only taken from
+// the request's targets field, where the scope policy applies to them, so
+// positional arguments are rejected.
+func parseScanArgs(args []string) (*nmapArgs, error) {
+	parsed, err := parseNmapArgs(args)
+	if err == nil && len(parsed.Targets) > 0 {
+		err = fmt.Errorf("unexpected argument %q: targets must be given in the targets field, not in args", parsed.Targets[0])
+	}
+	if err != nil {
+		return nil, toolerr.New(ToolName, "validate", toolerr.ErrCodeInvalidInput,
+			fmt.Sprintf("invalid nmap arguments: %v", err)).
+			WithCause(err).
+			WithClass(toolerr.ErrorClassSemantic)
+	}
+	return parsed, nil
+}
+
+// parseShort parses the short option cluster at args[i] and returns how many
+// following arguments it consumed as values
+func (a *nmapArgs) parseShort(args []string, i int) (int, error) {
+	arg := args[i]
+	for j := 1; j < len(arg); j++ {
+		c := arg[j]
+		if !isShortOption(c) {
+			return 0, fmt.Errorf("unrecognized option -%c in %s", c, arg)
+		}
+
+		switch nmapShortOptions[c] {
+		case noArg:
+			a.add(nmapOption{Name: "-" + string(c), Raw: arg})
+			continue
+
+		case optionalArg:
+			a.add(nmapOption{Name: "-" + string(c), Value: arg[j+1:], Raw: arg})
+			return 0, nil
+
+		case requiredArg:
+			value := arg[j+1:]
+			consumed := 0
+			if value == "" {
+				if i+1 >= len(args) {
+					return 0, fmt.Errorf("option -%c requires a value", c)
+				}
+				value = args[i+1]
+				consumed = 1
+			}
+			if err := a.addShortWithValue(c, value, arg); err != nil {
+				return 0, err
+			}
+			return consumed, nil
+		}
+	}
+	return 0, nil
+}
+
+// addShortWithValue adds a short option that takes a value, expanding combined
+// scan types and ping probes into their canonical options
+func (a *nmapArgs) addShortWithValue(c byte, value, raw string) error {
+	switch c {
+	case 's':
+		if value == "" {
+			return fmt.Errorf("option -s requires a scan type in %s", raw)
+		}
+		for k := 0; k < len(value); k++ {
+			name, ok := scanTechniques[value[k]]
+			if !ok {
+				return fmt.Errorf("unknown scan type -s%c in %s", value[k], raw)
+			}
+			a.add(nmapOption{Name: name, Raw: raw})
+		}
+	case 'P':
+		if value == "" {
+			return fmt.Errorf("option -P requires a probe type in %s", raw)
+		}
+		name, ok := pingProbes[value[0]]
+		if !ok {
+			return fmt.Errorf("unknown host discovery option -P%c in %s", value[0], raw)
+		}
+		a.add(nmapOption{Name: name, Value: value[1:], Raw: raw})
+	default:
+		a.add(nmapOption{Name: "-" + string(c), Value: value, Raw: raw})
+	}
+	return nil
+}
+
+// add appends an option and any options it implies
+func (a *nmapArgs) add(option nmapOption) {
+	a.Options = append(a.Options, option)
+	for _, implied := range impliedOptions[option.Name] {
+		a.Options = append(a.Options, nmapOption{Name: implied, Raw: option.Raw, Implied: true})
+	}
+}
+
+// lookupLongOption finds a long option by exact name or unambiguous prefix.
+// Returns nil without error if nothing matches.
+func lookupLongOption(name string) (*longOption, error) {
+	if option, ok := nmapLongOptions[name]; ok {
+		return &option, nil
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	var found *longOption
+	for spelling, option := range nmapLongOptions {
+		if !strings.HasPrefix(spelling, name) {
+			continue
+		}
+		if found != nil && found.name != option.name {
+			return nil, fmt.Errorf("ambiguous option abbreviation")
+		}
+		option := option
+		found = &option
+	}
+	return found, nil
+}
+
+// isShortOption reports whether c is one of nmap's short option letters
+func isShortOption(c byte) bool {
+	_, ok := nmapShortOptions[c]
+	return ok
+}
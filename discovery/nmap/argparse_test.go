@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+	"github.com/zero-day-ai/sdk/types"
+)
+
+func TestParseNmapArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantNames   []string
+		wantTargets []string
+	}{
+		{
+			name:      "separate scan types",
+			args:      []string{"-sS", "-sV"},
+			wantNames: []string{"-sS", "-sV"},
+		},
+		{
+			name:      "combined scan types",
+			args:      []string{"-sSVU"},
+			wantNames: []string{"-sS", "-sV", "-sU"},
+		},
+		{
+			name:      "aggressive implies detection options",
+			args:      []string{"-A"},
+			wantNames: []string{"-A", "-O", "-sV", "-sC", "--traceroute"},
+		},
+		{
+			name:      "ping probes",
+			args:      []string{"-PE", "-PS22,80", "-Pn", "-PY"},
+			wantNames: []string{"-PE", "-PS", "-Pn", "-PY"},
+		},
+		{
+			name:      "legacy spellings",
+			args:      []string{"-sP", "-P0", "-PI"},
+			wantNames: []string{"-sn", "-Pn", "-PE"},
+		},
+		{
+			name:      "values are not flags",
+			args:      []string{"-p", "-sS", "--script", "-O", "--data-string", "-sU"},
+			wantNames: []string{"-p", "--script", "--data-string"},
+		},
+		{
+			name:      "clustered short options",
+			args:      []string{"-nFT4"},
+			wantNames: []string{"-n", "-F", "-T"},
+		},
+		{
+			name:      "optional values stay attached",
+			args:      []string{"-d", "-v3", "-O", "-sT"},
+			wantNames: []string{"-d", "-v", "-O", "-sT"},
+		},
+		{
+			name:      "long options with one or two dashes",
+			args:      []string{"-traceroute", "--host-timeout=5m", "--max-retries", "2"},
+			wantNames: []string{"--traceroute", "--host-timeout", "--max-retries"},
+		},
+		{
+			name:      "abbreviated long option",
+			args:      []string{"--trace", "--send-e"},
+			wantNames: []string{"--traceroute", "--send-eth"},
+		},
+		{
+			name:      "underscore spelling",
+			args:      []string{"--spoof_mac", "0"},
+			wantNames: []string{"--spoof-mac"},
+		},
+		{
+			name:      "doubled short options",
+			args:      []string{"-ff", "-vv"},
+			wantNames: []string{"-f", "-v"},
+		},
+		{
+			name:      "idle scan takes a zombie host",
+			args:      []string{"-sI", "zombie.example.com"},
+			wantNames: []string{"-sI"},
+		},
+		{
+			name:        "positional arguments",
+			args:        []string{"-sT", "10.0.0.1", "--", "-weird-host"},
+			wantNames:   []string{"-sT"},
+			wantTargets: []string{"10.0.0.1", "-weird-host"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, option := range parsed.Options {
+				names = append(names, option.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("expected options %v, got %v", tt.wantNames, names)
+			}
+			if !reflect.DeepEqual(parsed.Targets, tt.wantTargets) {
+				t.Errorf("expected targets %v, got %v", tt.wantTargets, parsed.Targets)
+			}
+		})
+	}
+}
+
+func TestParseNmapArgsValues(t *testing.T) {
+	parsed, err := parseNmapArgs([]string{"-p22,80", "-PS443", "--top-ports", "100", "-T4", "--script=default,safe", "-p", "U:53"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := parsed.values("-p"); !reflect.DeepEqual(got, []string{"22,80", "U:53"}) {
+		t.Errorf("unexpected -p values: %v", got)
+	}
+	if got := parsed.values("-PS"); !reflect.DeepEqual(got, []string{"443"}) {
+		t.Errorf("unexpected -PS values: %v", got)
+	}
+	if got := parsed.values("--top-ports"); !reflect.DeepEqual(got, []string{"100"}) {
+		t.Errorf("unexpected --top-ports values: %v", got)
+	}
+	if got := parsed.values("-T"); !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("unexpected -T values: %v", got)
+	}
+	if got := parsed.values("--script"); !reflect.DeepEqual(got, []string{"default,safe"}) {
+		t.Errorf("unexpected --script values: %v", got)
+	}
+}
+
+func TestParseNmapArgsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unknown long option", args: []string{"--no-such-option"}},
+		{name: "unknown short option", args: []string{"-sT", "-j"}},
+		{name: "unknown scan type", args: []string{"-sQ"}},
+		{name: "unknown ping type", args: []string{"-PQ"}},
+		{name: "missing value", args: []string{"-sT", "-p"}},
+		{name: "missing long value", args: []string{"--host-timeout"}},
+		{name: "value on flag", args: []string{"--traceroute=yes"}},
+		{name: "ambiguous abbreviation", args: []string{"--max-r", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseNmapArgs(tt.args); err == nil {
+				t.Errorf("expected error for %v", tt.args)
+			}
+		})
+	}
+}
+
+func TestValidateFlags(t *testing.T) {
+	caps := &types.Capabilities{
+		BlockedArgs:     privilegedFlags,
+		ArgAlternatives: flagAlternatives,
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantBlocked string
+		wantAlt     string
+	}{
+		{name: "connect scan allowed", args: []string{"-sT", "-sV", "-sC", "-p", "22", "-T4"}},
+		{name: "value that looks like a flag", args: []string{"-sT", "--script", "-O"}},
+		{name: "syn scan", args: []string{"-sS"}, wantBlocked: "'-sS'", wantAlt: "-sT"},
+		{name: "combined syn and version", args: []string{"-sSV"}, wantBlocked: "'-sS' (in '-sSV')", wantAlt: "-sT"},
+		{name: "combined udp", args: []string{"-sTU"}, wantBlocked: "'-sU' (in '-sTU')"},
+		{name: "aggressive", args: []string{"-sT", "-A"}, wantBlocked: "'-O' (implied by '-A')"},
+		{name: "icmp ping", args: []string{"-sn", "-PE"}, wantBlocked: "'-PE'"},
+		{name: "udp ping", args: []string{"-sn", "-PU53"}, wantBlocked: "'-PU' (in '-PU53')"},
+		{name: "sctp scan", args: []string{"-sY"}, wantBlocked: "'-sY'"},
+		{name: "protocol scan", args: []string{"-sO"}, wantBlocked: "'-sO'"},
+		{name: "raw ethernet", args: []string{"-sT", "--send-eth"}, wantBlocked: "'--send-eth'"},
+		{name: "decoys", args: []string{"-sT", "-D", "RND:10"}, wantBlocked: "'-D'"},
+		{name: "abbreviated traceroute", args: []string{"-sT", "--trace"}, wantBlocked: "'--traceroute' (in '--trace')"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			option, alt, blocked := validateFlags(caps, parsed)
+			if tt.wantBlocked == "" {
+				if blocked {
+					t.Errorf("expected %v to be allowed, got %s blocked", tt.args, option)
+				}
+				return
+			}
+			if !blocked {
+				t.Fatalf("expected %v to be blocked", tt.args)
+			}
+			if option.String() != tt.wantBlocked {
+				t.Errorf("expected blocked option %s, got %s", tt.wantBlocked, option)
+			}
+			if alt != tt.wantAlt {
+				t.Errorf("expected alternative %q, got %q", tt.wantAlt, alt)
+			}
+		})
+	}
+}
+
+func TestExecuteProtoPositionalArgs(t *testing.T) {
+	tool := NewTool()
+
+	_, err := tool.ExecuteProto(context.Background(), &toolspb.NmapRequest{
+		Targets: []string{"192.168.1.1"},
+		Args:    []string{"-sT", "10.0.0.1"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "targets must be given in the targets field") {
+		t.Errorf("expected positional argument to be rejected, got %v", err)
+	}
+
+	_, err = tool.ExecuteProto(context.Background(), &toolspb.NmapRequest{
+		Targets: []string{"192.168.1.1"},
+		Args:    []string{"-sT", "--bogus"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid nmap arguments") {
+		t.Errorf("expected unknown option to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// blockedOptions are nmap options that read or write local files, keyed by
+// their canonical name as parseNmapArgs reports them. The parser resolves
+// abbreviations, single-dash long options and short option clusters, so
+// -nFoN/tmp/x is checked as -o and --datad as --datadir.
+var blockedOptions = map[string]string{
+	"-o":                 "writes scan output to a file",
+	"-oN":                "writes scan output to a file",
+	"-oX":                "writes scan output to a file",
+	"-oS":                "writes scan output to a file",
+	"-oG":                "writes scan output to a file",
+	"-oA":                "writes scan output to files",
+	"-oM":                "writes scan output to a file",
+	"-oH":                "writes scan output to a file",
+	"-m":                 "writes scan output to a file",
+	"--append-output":    "appends scan output to existing files",
+	"-i":                 "reads targets from a file",
+	"-iL":                "reads targets from a file",
+	"--excludefile":      "reads exclusions from a file",
+	"--resume":           "reads a previous scan's output file",
+	"--datadir":          "loads nmap data files from a custom directory",
+	"--servicedb":        "loads a custom services file",
+	"--versiondb":        "loads a custom service probes file",
+	"--script-args-file": "reads script arguments from a file",
+	"--script-updatedb":  "rewrites the script database",
+	"--stylesheet":       "references a local stylesheet from the output",
+}
+
+// blockedScriptArgKeys are NSE script arguments that name local files or
+// directories to read or write, matched against the last dotted segment of the
+// key (e.g. "brute.credfile"). Keys ending in "file" or "db" are blocked too.
+var blockedScriptArgKeys = map[string]bool{
+	"userdb":      true, // unpwdb username list
+	"passdb":      true, // unpwdb password list
+	"credfile":    true, // brute credential list
+	"destination": true, // http-fetch writes fetched files here
+	"hostlist":    true, // dns-brute subdomain list
+	"filelist":    true, // tftp-enum file name list
+	"config":      true, // smb-psexec configuration file
+}
+
+// scriptArgKeyRegex extracts keys from a --script-args value such as
+// "userdb=users.txt,http.useragent=x,{a=b}"
+var scriptArgKeyRegex = regexp.MustCompile(`(?:^|[,{])\s*([A-Za-z0-9_.-]+)\s*=`)
+
+// checkArgumentPolicy rejects arguments that make nmap read or write local
+// files: output redirection, target and data files, custom data directories,
+// NSE scripts loaded by path and script arguments that name files. It checks
+// the parsed options, so every spelling nmap accepts is covered, and is
+// independent of the privilege checks in validateFlags.
+func checkArgumentPolicy(args *nmapArgs) error {
+	for _, option := range args.Options {
+		if reason, ok := blockedOptions[option.Name]; ok {
+			return fmt.Errorf("argument %q is not allowed: %s", option.Raw, reason)
+		}
+	}
+
+	for _, value := range args.values("--script") {
+		if script := scriptPath(value); script != "" {
+			return fmt.Errorf("script %q is not allowed: scripts must be referenced by name or category, not by path", script)
+		}
+	}
+	for _, value := range args.values("--script-args") {
+		if key := fileScriptArg(value); key != "" {
+			return fmt.Errorf("script argument %q is not allowed: it names a local file", key)
+		}
+	}
+	return nil
+}
+
+// scriptPath returns the first entry of a --script value that refers to a file
+// or directory path rather than a script name or category
+func scriptPath(value string) string {
+	entries := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '(' || r == ')' || r == ' '
+	})
+	for _, entry := range entries {
+		entry = strings.TrimPrefix(entry, "+")
+		if strings.ContainsAny(entry, `/\`) || strings.HasPrefix(entry, ".") ||
+			strings.HasPrefix(entry, "~") || strings.HasSuffix(entry, ".nse") {
+			return entry
+		}
+	}
+	return ""
+}
+
+// fileScriptArg returns the first key of a --script-args value that names a file
+func fileScriptArg(value string) string {
+	for _, match := range scriptArgKeyRegex.FindAllStringSubmatch(value, -1) {
+		key := match[1]
+		last := key[strings.LastIndex(key, ".")+1:]
+		if blockedScriptArgKeys[last] || strings.HasSuffix(last, "file") || strings.HasSuffix(last, "db") {
+			return key
+		}
+	}
+	return ""
+}
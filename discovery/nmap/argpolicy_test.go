@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+func TestCheckArgumentPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		blocked bool
+	}{
+		// Allowed
+		{name: "plain scan", args: []string{"-sT", "-T4", "-p", "22,80"}},
+		{name: "all ports", args: []string{"-p-", "-sV"}},
+		{name: "open only", args: []string{"--open", "-sT"}},
+		{name: "os scan guess", args: []string{"-O", "--osscan-guess"}},
+		{name: "debug", args: []string{"-d", "-sT"}},
+		{name: "random targets", args: []string{"-iR", "10", "-sn"}},
+		{name: "exclude hosts", args: []string{"--exclude", "10.0.0.1"}},
+		{name: "data payload", args: []string{"--data", "deadbeef"}},
+		{name: "script by name", args: []string{"--script", "http-title,ssl-cert"}},
+		{name: "script categories", args: []string{"--script=default,safe"}},
+		{name: "script expression", args: []string{"--script", "(default or safe) and not intrusive"}},
+		{name: "script wildcard", args: []string{"--script", "+smb-vuln-*"}},
+		{name: "script args", args: []string{"--script", "http-title", "--script-args", "http.useragent=scanner,http-title.url=/admin/"}},
+		{name: "single dash script", args: []string{"-script", "default"}},
+
+		// Output redirection
+		{name: "normal output", args: []string{"-oN", "/etc/cron.d/x"}, blocked: true},
+		{name: "xml output", args: []string{"-oX", "/tmp/out.xml"}, blocked: true},
+		{name: "grepable output attached", args: []string{"-oG/tmp/out"}, blocked: true},
+		{name: "all formats double dash", args: []string{"--oA", "/tmp/out"}, blocked: true},
+		{name: "script kiddie output", args: []string{"-oS", "x"}, blocked: true},
+		{name: "bare output flag", args: []string{"-o", "x"}, blocked: true},
+		{name: "output in short cluster", args: []string{"-nFoN/etc/cron.d/x"}, blocked: true},
+		{name: "output type in short cluster", args: []string{"-noutput.txt"}, blocked: true},
+		{name: "legacy machine output", args: []string{"-m", "/etc/cron.d/x"}, blocked: true},
+		{name: "legacy machine output attached", args: []string{"-m/etc/cron.d/x"}, blocked: true},
+		{name: "append output", args: []string{"--append-output", "-sT"}, blocked: true},
+		{name: "output abbreviated long option", args: []string{"--oN=/tmp/out"}, blocked: true},
+
+		// Files and directories
+		{name: "input list", args: []string{"-iL", "/etc/shadow"}, blocked: true},
+		{name: "input list attached", args: []string{"-iL/etc/shadow"}, blocked: true},
+		{name: "input in short cluster", args: []string{"-ni/etc/shadow"}, blocked: true},
+		{name: "exclude file abbreviated", args: []string{"--excludef", "/etc/hosts"}, blocked: true},
+		{name: "exclude file", args: []string{"--excludefile", "/etc/hosts"}, blocked: true},
+		{name: "datadir", args: []string{"--datadir", "/tmp"}, blocked: true},
+		{name: "datadir with value", args: []string{"--datadir=/tmp"}, blocked: true},
+		{name: "datadir abbreviated", args: []string{"--datad", "/tmp"}, blocked: true},
+		{name: "datadir single dash", args: []string{"-datadir", "/tmp"}, blocked: true},
+		{name: "resume", args: []string{"--resume", "/tmp/scan.xml"}, blocked: true},
+		{name: "stylesheet", args: []string{"--stylesheet", "/tmp/x.xsl"}, blocked: true},
+		{name: "servicedb", args: []string{"--servicedb", "/tmp/services"}, blocked: true},
+		{name: "versiondb", args: []string{"--versiondb", "/tmp/probes"}, blocked: true},
+		{name: "script args file", args: []string{"--script-args-file", "/tmp/args"}, blocked: true},
+		{name: "script updatedb", args: []string{"--script-updatedb"}, blocked: true},
+
+		// Scripts
+		{name: "script by absolute path", args: []string{"--script", "/tmp/evil.nse"}, blocked: true},
+		{name: "script by relative path", args: []string{"--script", "default,./evil"}, blocked: true},
+		{name: "script file name", args: []string{"--script=evil.nse"}, blocked: true},
+		{name: "script directory", args: []string{"--script", "~/scripts"}, blocked: true},
+		{name: "script userdb", args: []string{"--script-args", "userdb=/etc/passwd"}, blocked: true},
+		{name: "script credfile", args: []string{"--script-args=brute.credfile=/tmp/creds"}, blocked: true},
+		{name: "script fetch destination", args: []string{"--script", "http-fetch", "--script-args", "http-fetch.destination=/etc/cron.d"}, blocked: true},
+		{name: "script host list", args: []string{"--script-args", "dns-brute.hostlist=/etc/shadow"}, blocked: true},
+		{name: "script communities db", args: []string{"--script-args=snmp-brute.communitiesdb=/root/.ssh/id_rsa"}, blocked: true},
+		{name: "script file list", args: []string{"--script-args", "tftp-enum.filelist=/etc/passwd"}, blocked: true},
+		{name: "script psexec config", args: []string{"--script-args", "smb-psexec.config=/tmp/x"}, blocked: true},
+		{name: "script file arg in table", args: []string{"--script-args", "x={y=1},http.outfile=/tmp/x"}, blocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			err = checkArgumentPolicy(parsed)
+			if tt.blocked && err == nil {
+				t.Errorf("expected %v to be blocked", tt.args)
+			}
+			if !tt.blocked && err != nil {
+				t.Errorf("expected %v to be allowed, got %v", tt.args, err)
+			}
+		})
+	}
+}
+
+func TestExecuteProtoArgumentPolicy(t *testing.T) {
+	tool := NewTool()
+
+	_, err := tool.ExecuteProto(context.Background(), &toolspb.NmapRequest{
+		Targets: []string{"192.168.1.1"},
+		Args:    []string{"-sT", "-oN", "/etc/cron.d/x"},
+	})
+	if err == nil {
+		t.Fatal("expected policy violation, got nil")
+	}
+
+	if !strings.Contains(err.Error(), `argument "-oN" is not allowed`) {
+		t.Errorf("expected policy violation for -oN, got %v", err)
+	}
+}
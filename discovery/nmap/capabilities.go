@@ -10,16 +10,35 @@ import (
 // privilegedFlags contains nmap flags that require root/sudo/raw socket privileges.
 // These operations perform low-level network operations that require elevated access.
 var privilegedFlags = []string{
-	"-O",          // OS detection - requires raw packet access
-	"-sS",         // SYN scan - requires raw socket for TCP SYN packets
-	"-sA",         // ACK scan - requires raw socket for TCP ACK packets
-	"-sW",         // Window scan - requires raw socket access
-	"-sM",         // Maimon scan - requires raw socket access
-	"-sN",         // Null scan - requires raw socket for crafted packets
-	"-sF",         // FIN scan - requires raw socket for TCP FIN packets
-	"-sX",         // Xmas scan - requires raw socket for crafted packets
+	"-O",           // OS detection - requires raw packet access
+	"-sS",          // SYN scan - requires raw socket for TCP SYN packets
+	"-sA",          // ACK scan - requires raw socket for TCP ACK packets
+	"-sW",          // Window scan - requires raw socket access
+	"-sM",          // Maimon scan - requires raw socket access
+	"-sN",          // Null scan - requires raw socket for crafted packets
+	"-sF",          // FIN scan - requires raw socket for TCP FIN packets
+	"-sX",          // Xmas scan - requires raw socket for crafted packets
 	"--traceroute", // Traceroute - requires raw socket for ICMP/UDP
-	"-sU",         // UDP scan - requires raw socket for UDP packets
+	"-sU",          // UDP scan - requires raw socket for UDP packets
+	"-sY",          // SCTP INIT scan - requires raw socket access
+	"-sZ",          // SCTP COOKIE-ECHO scan - requires raw socket access
+	"-sO",          // IP protocol scan - requires raw socket access
+	"-sI",          // Idle scan - requires spoofed raw packets
+	"-PE",          // ICMP echo ping - requires raw socket for ICMP
+	"-PP",          // ICMP timestamp ping - requires raw socket for ICMP
+	"-PM",          // ICMP netmask ping - requires raw socket for ICMP
+	"-PO",          // IP protocol ping - requires raw socket access
+	"-PU",          // UDP ping - requires raw socket for UDP probes
+	"-PY",          // SCTP ping - requires raw socket access
+	"--send-eth",   // Raw ethernet frames - requires raw link-layer access
+	"--send-ip",    // Raw IP packets - requires raw socket access
+	"-S",           // Source address spoofing - requires raw packets
+	"-D",           // Decoys - requires raw packets with spoofed sources
+	"--spoof-mac",  // MAC spoofing - requires raw ethernet frames
+	"-f",           // Fragmentation - requires crafting raw IP packets
+	"--mtu",        // Custom fragment size - requires crafting raw IP packets
+	"--badsum",     // Bad checksums - requires crafting raw packets
+	"--ip-options", // IP options - requires crafting raw IP packets
 }
 
 // flagAlternatives maps privileged nmap flags to their unprivileged equivalents.
@@ -72,12 +91,12 @@ func (t *ToolImpl) Capabilities(ctx context.Context) *types.Capabilities {
 	caps.ArgAlternatives = flagAlternatives
 
 	// Set feature availability for unprivileged execution
-	caps.Features["os_detection"] = false   // -O requires raw socket
-	caps.Features["syn_scan"] = false       // -sS requires raw socket
-	caps.Features["udp_scan"] = false       // -sU requires raw socket
-	caps.Features["traceroute"] = false     // --traceroute requires raw socket
-	caps.Features["service_detect"] = true  // -sV works without privileges
-	caps.Features["script_scan"] = true     // -sC works without privileges
+	caps.Features["os_detection"] = false  // -O requires raw socket
+	caps.Features["syn_scan"] = false      // -sS requires raw socket
+	caps.Features["udp_scan"] = false      // -sU requires raw socket
+	caps.Features["traceroute"] = false    // --traceroute requires raw socket
+	caps.Features["service_detect"] = true // -sV works without privileges
+	caps.Features["script_scan"] = true    // -sC works without privileges
 
 	return caps
 }
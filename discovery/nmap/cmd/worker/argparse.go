@@ -0,0 +1 @@
+../../argparse.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../argpolicy.go
\ No newline at end of file
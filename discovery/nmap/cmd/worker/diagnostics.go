@@ -0,0 +1 @@
+../../diagnostics.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../downgrade.go
\ No newline at end of file
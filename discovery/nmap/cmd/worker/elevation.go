@@ -0,0 +1 @@
+../../elevation.go
\ No newline at end of file
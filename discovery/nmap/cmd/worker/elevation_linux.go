@@ -0,0 +1 @@
+../../elevation_linux.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../elevation_other.go
\ No newline at end of file
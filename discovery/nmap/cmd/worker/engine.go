@@ -0,0 +1 @@
+../../engine.go
\ No newline at end of file
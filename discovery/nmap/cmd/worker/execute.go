@@ -0,0 +1 @@
+../../execute.go
\ No newline at end of file
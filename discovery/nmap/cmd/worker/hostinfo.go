@@ -0,0 +1 @@
+../../hostinfo.go
\ No newline at end of file
@@ -0,0 +1 @@
+../../procgroup.go
\ No newline at end of file
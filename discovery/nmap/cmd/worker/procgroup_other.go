@@ -0,0 +1 @@
+../../procgroup_other.go
\ No newline at end of file
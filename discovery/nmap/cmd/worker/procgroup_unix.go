@@ -0,0 +1 @@
+../../procgroup_unix.go
\ No newline at end of file
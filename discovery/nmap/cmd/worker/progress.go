@@ -0,0 +1 @@
+../../progress.go
\ No newline at end of file
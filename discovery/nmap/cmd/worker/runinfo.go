@@ -0,0 +1 @@
+../../runinfo.go
\ No newline at end of file
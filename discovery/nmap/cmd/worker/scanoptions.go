@@ -0,0 +1 @@
+../../scanoptions.go
\ No newline at end of file
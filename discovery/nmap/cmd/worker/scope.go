@@ -0,0 +1 @@
+../../scope.go
\ No newline at end of file
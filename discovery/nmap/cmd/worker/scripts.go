@@ -0,0 +1 @@
+../../scripts.go
\ No newline at end of file
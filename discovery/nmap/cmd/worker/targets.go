@@ -0,0 +1 @@
+../../targets.go
\ No newline at end of file
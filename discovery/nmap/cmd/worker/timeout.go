@@ -0,0 +1 @@
+../../timeout.go
\ No newline at end of file
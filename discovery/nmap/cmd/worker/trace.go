@@ -0,0 +1 @@
+../../trace.go
\ No newline at end of file
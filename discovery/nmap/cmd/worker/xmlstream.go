@@ -0,0 +1 @@
+../../xmlstream.go
\ No newline at end of file
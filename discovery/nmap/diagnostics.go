@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+	"github.com/zero-day-ai/sdk/toolerr"
+)
+
+// Diagnostic severities
+const (
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// Diagnostic codes for conditions nmap reports on stderr
+const (
+	diagResolveFailed      = "resolve_failed"
+	diagInvalidTarget      = "invalid_target"
+	diagNoTargets          = "no_targets"
+	diagDeviceUnavailable  = "device_unavailable"
+	diagRawScanUnsupported = "raw_scan_unsupported"
+	diagPrivilegesRequired = "privileges_required"
+	diagSendFailed         = "send_failed"
+	diagRetransmissionCap  = "retransmission_cap"
+	diagFatal              = "fatal"
+)
+
+// maxDiagnostics caps how many diagnostics are kept from one scan
+const maxDiagnostics = 50
+
+// stderrPattern maps a known nmap stderr message to a diagnostic
+type stderrPattern struct {
+	regex    *regexp.Regexp
+	code     string
+	severity string
+	class    toolerr.ErrorClass
+}
+
+// stderrPatterns are checked in order; the first match wins
+var stderrPatterns = []stderrPattern{
+	{regexp.MustCompile(`^Failed to resolve "?[^"]*"?`), diagResolveFailed, severityWarning, toolerr.ErrorClassSemantic},
+	{regexp.MustCompile(`Unable to split netmask|Failed to resolve given hostname/IP|Illegal netmask`), diagInvalidTarget, severityWarning, toolerr.ErrorClassSemantic},
+	{regexp.MustCompile(`^WARNING: No targets were specified`), diagNoTargets, severityWarning, toolerr.ErrorClassSemantic},
+	{regexp.MustCompile(`Failed to open device|Could not find interface|failed to determine route`), diagDeviceUnavailable, severityError, toolerr.ErrorClassInfrastructure},
+	{regexp.MustCompile(`Only ethernet devices can be used for raw scans`), diagRawScanUnsupported, severityError, toolerr.ErrorClassInfrastructure},
+	{regexp.MustCompile(`^sendto in .* failed`), diagSendFailed, severityWarning, toolerr.ErrorClassTransient},
+	{regexp.MustCompile(`requires root privileges|Operation not permitted`), diagPrivilegesRequired, severityError, toolerr.ErrorClassInfrastructure},
+	{regexp.MustCompile(`giving up on port because retransmission cap hit`), diagRetransmissionCap, severityWarning, toolerr.ErrorClassTransient},
+}
+
+// stderrDiagnostic is a classified nmap stderr message
+type stderrDiagnostic struct {
+	Code     string
+	Severity string
+	Message  string
+	Class    toolerr.ErrorClass
+	Cause    string // code of the condition behind a fatal error, if known
+}
+
+// reason is the most specific code for the diagnostic: the cause of a fatal
+// error if it is known, otherwise its own code
+func (d stderrDiagnostic) reason() string {
+	if d.Cause != "" {
+		return d.Cause
+	}
+	return d.Code
+}
+
+// stderrClassifier classifies nmap's stderr line by line, dropping repeats.
+// It remembers the previous line so a bare "QUITTING!" is reported with its cause.
+type stderrClassifier struct {
+	previousLine string
+	seen         map[string]bool
+	diagnostics  []stderrDiagnostic
+}
+
+// newStderrClassifier creates an empty classifier
+func newStderrClassifier() *stderrClassifier {
+	return &stderrClassifier{seen: make(map[string]bool)}
+}
+
+// line classifies one stderr line. It returns the diagnostic and true for a
+// new known condition; repeats and unknown lines return false.
+func (c *stderrClassifier) line(line string) (stderrDiagnostic, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return stderrDiagnostic{}, false
+	}
+
+	var diag stderrDiagnostic
+	var ok bool
+	if strings.Contains(line, "QUITTING!") {
+		diag, ok = c.fatal(line), true
+	} else {
+		diag, ok = matchStderr(line)
+	}
+	c.previousLine = line
+	if !ok {
+		return stderrDiagnostic{}, false
+	}
+
+	key := diag.Code + "\x00" + diag.Message
+	if c.seen[key] || len(c.diagnostics) >= maxDiagnostics {
+		return stderrDiagnostic{}, false
+	}
+	c.seen[key] = true
+	c.diagnostics = append(c.diagnostics, diag)
+	return diag, true
+}
+
+// fatal builds the diagnostic for nmap's fatal errors, which print the reason
+// followed by QUITTING! on the same line or the next. The error class is the
+// reason's, if it is a known condition.
+func (c *stderrClassifier) fatal(line string) stderrDiagnostic {
+	reason := strings.TrimSpace(strings.TrimSuffix(line, "QUITTING!"))
+	if reason == "" {
+		reason = c.previousLine
+	}
+
+	diag := stderrDiagnostic{
+		Code:     diagFatal,
+		Severity: severityError,
+		Message:  strings.TrimSpace("nmap quit: " + reason),
+		Class:    toolerr.ErrorClassInfrastructure,
+	}
+	if cause, ok := matchStderr(reason); ok {
+		diag.Class = cause.Class
+		diag.Cause = cause.Code
+	}
+	return diag
+}
+
+// matchStderr classifies a line against stderrPatterns
+func matchStderr(line string) (stderrDiagnostic, bool) {
+	for _, pattern := range stderrPatterns {
+		if pattern.regex.MatchString(line) {
+			return stderrDiagnostic{
+				Code:     pattern.code,
+				Severity: pattern.severity,
+				Message:  line,
+				Class:    pattern.class,
+			}, true
+		}
+	}
+	return stderrDiagnostic{}, false
+}
+
+// firstStderrError returns the first error-severity diagnostic, preferring
+// nmap's fatal message, or nil if there is none
+func firstStderrError(diagnostics []stderrDiagnostic) *stderrDiagnostic {
+	var first *stderrDiagnostic
+	for i := range diagnostics {
+		diag := &diagnostics[i]
+		if diag.Severity != severityError {
+			continue
+		}
+		if diag.Code == diagFatal {
+			return diag
+		}
+		if first == nil {
+			first = diag
+		}
+	}
+	return first
+}
+
+// stderrError is an execution error explained by a diagnostic nmap wrote to stderr
+type stderrError struct {
+	Diagnostic stderrDiagnostic
+	Err        error
+}
+
+func (e *stderrError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Diagnostic.Message, e.Err)
+}
+
+func (e *stderrError) Unwrap() error {
+	return e.Err
+}
+
+// withStderrDiagnostics wraps err with the first error nmap reported on stderr,
+// if any, so error classification can take it into account
+func withStderrDiagnostics(err error, diagnostics []stderrDiagnostic) error {
+	if err == nil {
+		return nil
+	}
+	var existing *stderrError
+	if errors.As(err, &existing) {
+		return err
+	}
+	if diag := firstStderrError(diagnostics); diag != nil {
+		return &stderrError{Diagnostic: *diag, Err: err}
+	}
+	return err
+}
+
+// convertDiagnostics converts diagnostics to their proto form
+func convertDiagnostics(diagnostics []stderrDiagnostic) []*toolspb.NmapDiagnostic {
+	var out []*toolspb.NmapDiagnostic
+	for _, diag := range diagnostics {
+		out = append(out, &toolspb.NmapDiagnostic{
+			Code:     diag.Code,
+			Severity: diag.Severity,
+			Message:  diag.Message,
+		})
+	}
+	return out
+}
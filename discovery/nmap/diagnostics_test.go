@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/toolerr"
+)
+
+// classifyLines feeds stderr output to a classifier line by line, as runScan does
+func classifyLines(stderr string) []stderrDiagnostic {
+	classifier := newStderrClassifier()
+	for _, line := range strings.Split(strings.TrimSuffix(stderr, "\n"), "\n") {
+		classifier.line(line)
+	}
+	return classifier.diagnostics
+}
+
+func TestStderrClassifier(t *testing.T) {
+	stderr := `Starting Nmap 7.94 ( https://nmap.org )
+Failed to resolve "notfound.local".
+Failed to resolve "notfound.local".
+Warning: 10.0.0.5 giving up on port because retransmission cap hit (6).
+Warning: 10.0.0.5 giving up on port because retransmission cap hit (6).
+Stats: 0:00:05 elapsed; 0 hosts completed (1 up), 1 undergoing SYN Stealth Scan
+WARNING: No targets were specified, so 0 hosts scanned.
+`
+
+	diagnostics := classifyLines(stderr)
+
+	expected := []struct {
+		code     string
+		severity string
+	}{
+		{diagResolveFailed, severityWarning},
+		{diagRetransmissionCap, severityWarning},
+		{diagNoTargets, severityWarning},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics without repeats, got %+v", len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		if diagnostics[i].Code != want.code || diagnostics[i].Severity != want.severity {
+			t.Errorf("diagnostic %d: expected %s/%s, got %+v", i, want.code, want.severity, diagnostics[i])
+		}
+	}
+	if diagnostics[0].Message != `Failed to resolve "notfound.local".` {
+		t.Errorf("expected the stderr line as message, got %q", diagnostics[0].Message)
+	}
+}
+
+func TestStderrClassifierFatal(t *testing.T) {
+	tests := []struct {
+		name         string
+		stderr       string
+		wantCodes    []string
+		wantFatalMsg string
+		wantClass    toolerr.ErrorClass
+	}{
+		{
+			name:         "device on its own line",
+			stderr:       "Failed to open device eth7\nQUITTING!\n",
+			wantCodes:    []string{diagDeviceUnavailable, diagFatal},
+			wantFatalMsg: "nmap quit: Failed to open device eth7",
+			wantClass:    toolerr.ErrorClassInfrastructure,
+		},
+		{
+			name:         "raw scan on a non-ethernet device",
+			stderr:       "Only ethernet devices can be used for raw scans on Windows, and\nQUITTING!\n",
+			wantCodes:    []string{diagRawScanUnsupported, diagFatal},
+			wantFatalMsg: "nmap quit: Only ethernet devices can be used for raw scans on Windows, and",
+			wantClass:    toolerr.ErrorClassInfrastructure,
+		},
+		{
+			name:         "reason on the same line",
+			stderr:       "Failed to resolve given hostname/IP: bad..host.  QUITTING!\n",
+			wantCodes:    []string{diagFatal},
+			wantFatalMsg: "nmap quit: Failed to resolve given hostname/IP: bad..host.",
+			wantClass:    toolerr.ErrorClassSemantic,
+		},
+		{
+			name:         "root required",
+			stderr:       "You requested a scan type which requires root privileges.\nQUITTING!\n",
+			wantCodes:    []string{diagPrivilegesRequired, diagFatal},
+			wantFatalMsg: "nmap quit: You requested a scan type which requires root privileges.",
+			wantClass:    toolerr.ErrorClassInfrastructure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := classifyLines(tt.stderr)
+
+			var codes []string
+			for _, diag := range diagnostics {
+				codes = append(codes, diag.Code)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.wantCodes, ",") {
+				t.Fatalf("expected codes %v, got %v", tt.wantCodes, codes)
+			}
+
+			fatal := firstStderrError(diagnostics)
+			if fatal == nil || fatal.Code != diagFatal {
+				t.Fatalf("expected the fatal diagnostic to explain the failure, got %+v", fatal)
+			}
+			if fatal.Message != tt.wantFatalMsg {
+				t.Errorf("expected message %q, got %q", tt.wantFatalMsg, fatal.Message)
+			}
+			if fatal.Class != tt.wantClass {
+				t.Errorf("expected class %v, got %v", tt.wantClass, fatal.Class)
+			}
+		})
+	}
+}
+
+func TestWithStderrDiagnostics(t *testing.T) {
+	exitErr := fmt.Errorf("exit status 1")
+
+	t.Run("no errors on stderr", func(t *testing.T) {
+		diagnostics := classifyLines("Warning: 10.0.0.5 giving up on port because retransmission cap hit (6).\n")
+		if err := withStderrDiagnostics(exitErr, diagnostics); err != exitErr {
+			t.Errorf("expected error unchanged, got %v", err)
+		}
+	})
+
+	t.Run("explained by stderr", func(t *testing.T) {
+		diagnostics := classifyLines("Failed to open device eth7\nQUITTING!\n")
+		err := withStderrDiagnostics(exitErr, diagnostics)
+
+		if !errors.Is(err, exitErr) {
+			t.Error("expected the original error to be wrapped")
+		}
+		if !strings.Contains(err.Error(), "Failed to open device eth7") {
+			t.Errorf("expected nmap's reason in the message, got %q", err.Error())
+		}
+		class, reason := classifyExecutionError(err)
+		if class != toolerr.ErrorClassInfrastructure {
+			t.Errorf("expected infrastructure class from stderr, got %v", class)
+		}
+		if reason != "DEVICE_UNAVAILABLE" {
+			t.Errorf("expected the fatal error's cause as reason, got %q", reason)
+		}
+	})
+
+	t.Run("nil error", func(t *testing.T) {
+		if err := withStderrDiagnostics(nil, classifyLines("QUITTING!\n")); err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+	})
+}
+
+func TestConvertDiagnostics(t *testing.T) {
+	diagnostics := classifyLines("Failed to resolve \"notfound.local\".\n")
+	converted := convertDiagnostics(diagnostics)
+	if len(converted) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(converted))
+	}
+	if converted[0].Code != diagResolveFailed || converted[0].Severity != severityWarning ||
+		converted[0].Message != `Failed to resolve "notfound.local".` {
+		t.Errorf("unexpected converted diagnostic: %+v", converted[0])
+	}
+}
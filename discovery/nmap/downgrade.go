@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zero-day-ai/sdk/types"
+)
+
+// udpFallbackScan replaces -sU when auto-downgrade leaves no other port scan.
+// nmap has no unprivileged UDP scan, so the fallback scans the TCP side of the
+// requested ports and the response warns that UDP results are missing.
+const udpFallbackScan = "-sT"
+
+// portScanTypes are the scan techniques that select how ports are probed
+var portScanTypes = map[string]bool{
+	"-sS": true, "-sT": true, "-sA": true, "-sW": true, "-sM": true, "-sN": true,
+	"-sF": true, "-sX": true, "-sU": true, "-sY": true, "-sZ": true, "-sO": true,
+	"-sI": true, "-sn": true, "-sL": true,
+}
+
+// downgradeArgs rewrites options that need privileges the tool lacks: options
+// with an alternative in caps are replaced by it, -sU falls back to
+// udpFallbackScan if nothing else would scan ports, and everything else is
+// dropped. Returns the rewritten arguments and a warning for each rewrite, or
+// the original arguments unchanged if nothing was blocked.
+func downgradeArgs(caps *types.Capabilities, args []string, parsed *nmapArgs) ([]string, *nmapArgs, []string) {
+	if caps == nil {
+		return args, parsed, nil
+	}
+	if _, _, blocked := validateFlags(caps, parsed); !blocked {
+		return args, parsed, nil
+	}
+
+	downgraded := &nmapArgs{Targets: parsed.Targets}
+	var warnings []string
+	droppedUDP := false
+
+	for _, option := range parsed.Options {
+		if !caps.IsArgBlocked(option.Name) {
+			if !option.Implied && !downgraded.hasFlag(option) {
+				downgraded.Options = append(downgraded.Options, option)
+			}
+			continue
+		}
+
+		if option.Name == "-sU" {
+			droppedUDP = true
+			continue
+		}
+
+		if alt, ok := caps.GetAlternative(option.Name); ok && alt != "" {
+			warnings = append(warnings, fmt.Sprintf("replaced %s with '%s': it requires elevated privileges", option, alt))
+			replacement := nmapOption{Name: alt, Value: option.Value, Raw: option.Raw}
+			if !downgraded.hasFlag(replacement) {
+				downgraded.Options = append(downgraded.Options, replacement)
+			}
+			continue
+		}
+
+		warnings = append(warnings, fmt.Sprintf("dropped %s: it requires elevated privileges", option))
+	}
+
+	// Options implied by a kept option (-A) that are now dropped must not come
+	// back through it, so expand it into the implied options that remain
+	downgraded.Options = expandImplied(downgraded.Options, caps)
+
+	if droppedUDP {
+		if downgraded.hasPortScan() {
+			warnings = append(warnings, "dropped '-sU': UDP scanning requires elevated privileges, UDP ports were not scanned")
+		} else {
+			warnings = append(warnings, fmt.Sprintf("replaced '-sU' with '%s': UDP scanning requires elevated privileges, only TCP ports were scanned", udpFallbackScan))
+			downgraded.Options = append(downgraded.Options, nmapOption{Name: udpFallbackScan, Raw: "-sU"})
+		}
+	}
+
+	return renderNmapArgs(downgraded), downgraded, warnings
+}
+
+// expandImplied replaces options with implications (-A) by the implied options
+// that are not blocked, so dropping one of them does not leave it re-enabled
+func expandImplied(options []nmapOption, caps *types.Capabilities) []nmapOption {
+	kept := &nmapArgs{Options: options}
+	var expanded []nmapOption
+	for _, option := range options {
+		implied, ok := impliedOptions[option.Name]
+		if !ok {
+			expanded = append(expanded, option)
+			continue
+		}
+
+		anyBlocked := false
+		for _, name := range implied {
+			if caps.IsArgBlocked(name) {
+				anyBlocked = true
+			}
+		}
+		if !anyBlocked {
+			expanded = append(expanded, option)
+			continue
+		}
+
+		for _, name := range implied {
+			if !caps.IsArgBlocked(name) && !kept.has(name) {
+				expanded = append(expanded, nmapOption{Name: name, Raw: option.Raw})
+			}
+		}
+	}
+	return expanded
+}
+
+// hasFlag reports whether an option without a value is already present, so
+// rewrites such as -sS to -sT next to an existing -sT do not repeat it
+func (a *nmapArgs) hasFlag(option nmapOption) bool {
+	if option.Value != "" || optionArgKind(option.Name) != noArg {
+		return false
+	}
+	for _, existing := range a.Options {
+		if existing.Name == option.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPortScan reports whether a scan technique (or -sn/-sL) is selected
+func (a *nmapArgs) hasPortScan() bool {
+	for _, option := range a.Options {
+		if portScanTypes[option.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// optionArgKind returns whether a canonical option name takes an argument
+func optionArgKind(name string) optionArg {
+	if option, ok := nmapLongOptions[strings.TrimLeft(name, "-")]; ok && option.name == name {
+		return option.arg
+	}
+	if len(name) == 2 {
+		return nmapShortOptions[name[1]]
+	}
+	// Scan techniques (-sS) take no argument; ping probes (-PS) take an attached one
+	if strings.HasPrefix(name, "-P") {
+		return optionalArg
+	}
+	return noArg
+}
+
+// renderNmapArgs turns parsed options back into an argument list, one option
+// per flag in canonical form with short option values attached (-T4, -p22),
+// followed by any positional arguments
+func renderNmapArgs(parsed *nmapArgs) []string {
+	var args []string
+	for _, option := range parsed.Options {
+		if option.Implied {
+			continue
+		}
+		kind := optionArgKind(option.Name)
+		switch {
+		case kind == requiredArg && len(option.Name) > 2:
+			args = append(args, option.Name, option.Value)
+		case kind != noArg:
+			args = append(args, option.Name+option.Value)
+		default:
+			args = append(args, option.Name)
+		}
+	}
+	if len(parsed.Targets) > 0 {
+		args = append(args, "--")
+		args = append(args, parsed.Targets...)
+	}
+	return args
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/types"
+)
+
+func TestDowngradeArgs(t *testing.T) {
+	caps := &types.Capabilities{
+		BlockedArgs:     privilegedFlags,
+		ArgAlternatives: flagAlternatives,
+	}
+
+	tests := []struct {
+		name         string
+		args         []string
+		expected     []string
+		wantWarnings []string
+	}{
+		{
+			name:     "nothing blocked is left untouched",
+			args:     []string{"-sT", "-T4", "-p22,80"},
+			expected: []string{"-sT", "-T4", "-p22,80"},
+		},
+		{
+			name:         "syn scan replaced",
+			args:         []string{"-sS", "-T4", "-p", "22"},
+			expected:     []string{"-sT", "-T4", "-p22"},
+			wantWarnings: []string{"replaced '-sS' with '-sT'"},
+		},
+		{
+			name:         "combined scan types",
+			args:         []string{"-sSV"},
+			expected:     []string{"-sT", "-sV"},
+			wantWarnings: []string{"replaced '-sS' (in '-sSV') with '-sT'"},
+		},
+		{
+			name:         "replacement not repeated",
+			args:         []string{"-sS", "-sA", "-sT"},
+			expected:     []string{"-sT"},
+			wantWarnings: []string{"replaced '-sS'", "replaced '-sA'"},
+		},
+		{
+			name:         "os detection and traceroute dropped",
+			args:         []string{"-sT", "-O", "--traceroute"},
+			expected:     []string{"-sT"},
+			wantWarnings: []string{"dropped '-O'", "dropped '--traceroute'"},
+		},
+		{
+			name:         "aggressive expanded without privileged parts",
+			args:         []string{"-A", "-sT"},
+			expected:     []string{"-sV", "-sC", "-sT"},
+			wantWarnings: []string{"dropped '-O' (implied by '-A')", "dropped '--traceroute' (implied by '-A')"},
+		},
+		{
+			name:         "udp alone falls back to connect scan",
+			args:         []string{"-sU", "-p", "53,161"},
+			expected:     []string{"-p53,161", "-sT"},
+			wantWarnings: []string{"replaced '-sU' with '-sT'"},
+		},
+		{
+			name:         "udp next to another scan is dropped",
+			args:         []string{"-sS", "-sU", "-p", "T:22,U:53"},
+			expected:     []string{"-sT", "-pT:22,U:53"},
+			wantWarnings: []string{"replaced '-sS'", "dropped '-sU'"},
+		},
+		{
+			name:         "spoofing options dropped with their values",
+			args:         []string{"-sT", "-D", "RND:5", "--spoof-mac", "0", "-PE", "--source-port", "53"},
+			expected:     []string{"-sT", "--source-port", "53"},
+			wantWarnings: []string{"dropped '-D'", "dropped '--spoof-mac'", "dropped '-PE'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			args, downgraded, warnings := downgradeArgs(caps, tt.args, parsed)
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("expected args %v, got %v", tt.expected, args)
+			}
+			if len(warnings) != len(tt.wantWarnings) {
+				t.Fatalf("expected %d warnings, got %v", len(tt.wantWarnings), warnings)
+			}
+			for i, want := range tt.wantWarnings {
+				if !strings.HasPrefix(warnings[i], want) {
+					t.Errorf("expected warning starting with %q, got %q", want, warnings[i])
+				}
+			}
+
+			// The rewritten arguments parse to the same options and pass validation
+			reparsed, err := parseNmapArgs(args)
+			if err != nil {
+				t.Fatalf("rewritten args do not parse: %v", err)
+			}
+			if option, _, blocked := validateFlags(caps, reparsed); blocked {
+				t.Errorf("rewritten args still contain blocked option %s", option)
+			}
+			if _, _, blocked := validateFlags(caps, downgraded); blocked {
+				t.Errorf("downgraded option set still contains blocked options")
+			}
+		})
+	}
+}
+
+func TestDowngradeArgsPrivileged(t *testing.T) {
+	args := []string{"-sS", "-O"}
+	parsed, err := parseNmapArgs(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, _, warnings := downgradeArgs(&types.Capabilities{}, args, parsed)
+	if !reflect.DeepEqual(got, args) || len(warnings) != 0 {
+		t.Errorf("expected args unchanged with privileges, got %v %v", got, warnings)
+	}
+}
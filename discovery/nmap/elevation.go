@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/zero-day-ai/sdk/types"
+)
+
+// Elevation strategies, recorded in the response's elevation_strategy
+const (
+	// elevationRoot runs nmap directly; the worker is already root
+	elevationRoot = "root"
+	// elevationPrivileged runs nmap --privileged so it uses the raw socket
+	// capability (CAP_NET_RAW) it would otherwise not assume it has
+	elevationPrivileged = "privileged"
+	// elevationSudo runs sudo -n nmap; -n fails instead of prompting for a password
+	elevationSudo = "sudo"
+	// elevationNone runs nmap without privileges
+	elevationNone = "unprivileged"
+)
+
+// sudoBinary is the command used for the sudo strategy
+const sudoBinary = "sudo"
+
+// capNetRaw is the Linux capability number of CAP_NET_RAW
+const capNetRaw = 13
+
+// chooseElevation picks how to run nmap. Scans without an option from
+// privilegedFlags are never elevated, so scripts and service probes do not run
+// with more privileges than they need; an explicit --unprivileged always wins.
+// Otherwise root needs nothing extra, and --privileged is preferred over sudo
+// as it grants less, but only if nmapRawCapable reports that the nmap binary
+// itself gets CAP_NET_RAW when executed. The worker's own raw socket capability
+// is not inherited by nmap.
+func chooseElevation(caps *types.Capabilities, parsed *nmapArgs, nmapRawCapable bool) string {
+	if caps == nil || parsed.has("--unprivileged") {
+		return elevationNone
+	}
+	if caps.HasRoot {
+		// nmap inherits the worker's uid whether or not it needs it
+		return elevationRoot
+	}
+	if !needsPrivileges(parsed) {
+		return elevationNone
+	}
+	switch {
+	case nmapRawCapable:
+		return elevationPrivileged
+	case caps.HasSudo:
+		return elevationSudo
+	default:
+		return elevationNone
+	}
+}
+
+// restrictCapabilities blocks the options in privilegedFlags when no
+// elevation strategy can run them: the worker is not root, sudo is not
+// available and the nmap binary gets no CAP_NET_RAW, or the arguments ask for
+// --unprivileged. The worker's own raw socket capability does not count, as
+// nmap does not inherit it. caps is returned unchanged if a strategy applies.
+func restrictCapabilities(caps *types.Capabilities, parsed *nmapArgs, nmapRawCapable bool) *types.Capabilities {
+	if caps == nil {
+		return nil
+	}
+	if !parsed.has("--unprivileged") && (caps.HasRoot || caps.HasSudo || nmapRawCapable) {
+		return caps
+	}
+
+	restricted := *caps
+	restricted.BlockedArgs = privilegedFlags
+	restricted.ArgAlternatives = flagAlternatives
+	return &restricted
+}
+
+// needsPrivileges reports whether the arguments use an option from privilegedFlags,
+// given or implied
+func needsPrivileges(parsed *nmapArgs) bool {
+	for _, flag := range privilegedFlags {
+		if parsed.has(flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// elevatedCommand returns the command and arguments that run nmap with args
+// under the given elevation strategy
+func elevatedCommand(strategy string, args []string) (string, []string) {
+	switch strategy {
+	case elevationSudo:
+		return sudoBinary, append([]string{"-n", BinaryName}, args...)
+	case elevationPrivileged:
+		return BinaryName, append([]string{"--privileged"}, args...)
+	default:
+		return BinaryName, args
+	}
+}
+
+// processCaps holds the capability sets from /proc/self/status that decide
+// what an executed program is granted
+type processCaps struct {
+	Ambient    uint64
+	Bounding   uint64
+	NoNewPrivs bool
+}
+
+// parseProcessCaps reads the CapAmb, CapBnd and NoNewPrivs fields of a
+// /proc/<pid>/status file
+func parseProcessCaps(status string) processCaps {
+	var caps processCaps
+	scanner := bufio.NewScanner(strings.NewReader(status))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "CapAmb":
+			caps.Ambient, _ = strconv.ParseUint(value, 16, 64)
+		case "CapBnd":
+			caps.Bounding, _ = strconv.ParseUint(value, 16, 64)
+		case "NoNewPrivs":
+			caps.NoNewPrivs = value == "1"
+		}
+	}
+	return caps
+}
+
+// grantsRawSocket reports whether a program executed by a process with these
+// capability sets, and with the given security.capability extended attribute
+// (nil if it has none), runs with CAP_NET_RAW. Ambient capabilities carry over
+// to programs without file capabilities; file capabilities apply only if they
+// are effective, within the bounding set and not disabled by no_new_privs.
+func (c processCaps) grantsRawSocket(fileCaps []byte) bool {
+	const bit = uint64(1) << capNetRaw
+	if fileCaps == nil {
+		return c.Ambient&bit != 0
+	}
+
+	// struct vfs_cap_data: magic_etc, then permitted and inheritable sets
+	// (low 32 bits first), all little endian
+	const vfsCapFlagsEffective = 0x000001
+	if len(fileCaps) < 12 || c.NoNewPrivs {
+		return false
+	}
+	magic := binary.LittleEndian.Uint32(fileCaps[0:4])
+	permitted := uint64(binary.LittleEndian.Uint32(fileCaps[4:8]))
+	return magic&vfsCapFlagsEffective != 0 && permitted&bit != 0 && c.Bounding&bit != 0
+}
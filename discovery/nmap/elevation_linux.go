@@ -0,0 +1,34 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// nmapRawCapable reports whether nmap, executed by this process, runs with
+// CAP_NET_RAW: from the ambient set, or from file capabilities on the binary
+func nmapRawCapable() bool {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	path, err := exec.LookPath(BinaryName)
+	if err != nil {
+		return false
+	}
+
+	var fileCaps []byte
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(path, "security.capability", buf)
+	switch {
+	case err == nil:
+		fileCaps = buf[:n]
+	case !errors.Is(err, syscall.ENODATA) && !errors.Is(err, syscall.ENOTSUP):
+		return false
+	}
+	return parseProcessCaps(string(status)).grantsRawSocket(fileCaps)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// nmapRawCapable is false where nmap's capabilities cannot be inspected, so
+// --privileged is never assumed
+func nmapRawCapable() bool {
+	return false
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/types"
+)
+
+func TestChooseElevation(t *testing.T) {
+	tests := []struct {
+		name       string
+		caps       *types.Capabilities
+		rawCapable bool
+		args       []string
+		expected   string
+	}{
+		{name: "no capabilities", caps: nil, args: []string{"-sS"}, expected: elevationNone},
+		{name: "unprivileged", caps: &types.Capabilities{}, args: []string{"-sS"}, expected: elevationNone},
+		{name: "root", caps: &types.Capabilities{HasRoot: true, HasSudo: true}, args: []string{"-sS"}, expected: elevationRoot},
+		{name: "raw socket preferred over sudo", caps: &types.Capabilities{HasSudo: true, CanRawSocket: true}, rawCapable: true, args: []string{"-sS"}, expected: elevationPrivileged},
+		{name: "worker raw socket not inherited by nmap", caps: &types.Capabilities{HasSudo: true, CanRawSocket: true}, args: []string{"-sS"}, expected: elevationSudo},
+		{name: "sudo", caps: &types.Capabilities{HasSudo: true}, args: []string{"-sS"}, expected: elevationSudo},
+		{name: "implied privileged option", caps: &types.Capabilities{HasSudo: true}, args: []string{"-A"}, expected: elevationSudo},
+		{name: "connect scan not elevated", caps: &types.Capabilities{HasSudo: true}, args: []string{"-sT"}, expected: elevationNone},
+		{name: "scripts not elevated", caps: &types.Capabilities{HasSudo: true}, rawCapable: true, args: []string{"-sT", "-sC", "--script", "http-title"}, expected: elevationNone},
+		{name: "explicit unprivileged", caps: &types.Capabilities{HasSudo: true}, args: []string{"-sS", "--unprivileged"}, expected: elevationNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := chooseElevation(tt.caps, parsed, tt.rawCapable); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRestrictCapabilities(t *testing.T) {
+	tests := []struct {
+		name        string
+		caps        *types.Capabilities
+		rawCapable  bool
+		args        []string
+		wantBlocked bool
+	}{
+		{name: "root", caps: &types.Capabilities{HasRoot: true}, args: []string{"-sS"}},
+		{name: "sudo", caps: &types.Capabilities{HasSudo: true}, args: []string{"-sS"}},
+		{name: "nmap binary has raw sockets", caps: &types.Capabilities{CanRawSocket: true}, rawCapable: true, args: []string{"-O"}},
+		{name: "only the worker has raw sockets", caps: &types.Capabilities{CanRawSocket: true}, args: []string{"-sS"}, wantBlocked: true},
+		{name: "explicit unprivileged", caps: &types.Capabilities{HasRoot: true}, args: []string{"-sS", "--unprivileged"}, wantBlocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			caps := restrictCapabilities(tt.caps, parsed, tt.rawCapable)
+			if blocked := caps.IsArgBlocked("-sS") && caps.IsArgBlocked("-O"); blocked != tt.wantBlocked {
+				t.Errorf("expected privileged flags blocked=%v, got %v", tt.wantBlocked, caps.BlockedArgs)
+			}
+			if blocked := checkPrivileges(caps, parsed) != nil; blocked != tt.wantBlocked {
+				t.Errorf("expected the scan to be rejected=%v", tt.wantBlocked)
+			}
+			if tt.wantBlocked && tt.caps.IsArgBlocked("-sS") {
+				t.Error("expected the original capabilities to be left unchanged")
+			}
+		})
+	}
+
+	t.Run("downgraded on request", func(t *testing.T) {
+		parsed, err := parseNmapArgs([]string{"-sS"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		caps := restrictCapabilities(&types.Capabilities{CanRawSocket: true}, parsed, false)
+		_, downgraded, _ := downgradeArgs(caps, []string{"-sS"}, parsed)
+		if !downgraded.has("-sT") || downgraded.has("-sS") {
+			t.Errorf("expected a connect scan, got %+v", downgraded.Options)
+		}
+		if elevation := chooseElevation(caps, downgraded, false); elevation != elevationNone {
+			t.Errorf("expected no elevation, got %q", elevation)
+		}
+	})
+
+	if restrictCapabilities(nil, &nmapArgs{}, false) != nil {
+		t.Error("expected nil capabilities to stay nil")
+	}
+}
+
+func TestElevatedCommand(t *testing.T) {
+	args := []string{"-oX", "-", "-sS", "192.168.1.1"}
+
+	tests := []struct {
+		strategy     string
+		expectedName string
+		expectedArgs []string
+	}{
+		{elevationNone, "nmap", args},
+		{elevationRoot, "nmap", args},
+		{elevationPrivileged, "nmap", []string{"--privileged", "-oX", "-", "-sS", "192.168.1.1"}},
+		{elevationSudo, "sudo", []string{"-n", "nmap", "-oX", "-", "-sS", "192.168.1.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			name, got := elevatedCommand(tt.strategy, args)
+			if name != tt.expectedName {
+				t.Errorf("expected command %q, got %q", tt.expectedName, name)
+			}
+			if !reflect.DeepEqual(got, tt.expectedArgs) {
+				t.Errorf("expected args %v, got %v", tt.expectedArgs, got)
+			}
+		})
+	}
+}
+
+func TestParseProcessCaps(t *testing.T) {
+	status := `Name:	worker
+CapInh:	0000000000000000
+CapPrm:	0000000000002000
+CapEff:	0000000000002000
+CapBnd:	00000000a80425fb
+CapAmb:	0000000000002000
+NoNewPrivs:	1
+`
+	caps := parseProcessCaps(status)
+	if caps.Ambient != 1<<capNetRaw || caps.Bounding != 0xa80425fb || !caps.NoNewPrivs {
+		t.Errorf("unexpected capability sets: %+v", caps)
+	}
+}
+
+func TestGrantsRawSocket(t *testing.T) {
+	// vfs_cap_data revision 2 with CAP_NET_RAW permitted
+	fileCaps := func(effective bool) []byte {
+		data := make([]byte, 20)
+		magic := uint32(0x02000000)
+		if effective {
+			magic |= 1
+		}
+		binary.LittleEndian.PutUint32(data[0:4], magic)
+		binary.LittleEndian.PutUint32(data[4:8], 1<<capNetRaw)
+		return data
+	}
+	const netRaw = uint64(1) << capNetRaw
+
+	tests := []struct {
+		name     string
+		caps     processCaps
+		fileCaps []byte
+		expected bool
+	}{
+		{name: "no capabilities", caps: processCaps{Bounding: netRaw}, expected: false},
+		{name: "ambient", caps: processCaps{Ambient: netRaw, Bounding: netRaw}, expected: true},
+		{name: "file capabilities", caps: processCaps{Bounding: netRaw}, fileCaps: fileCaps(true), expected: true},
+		{name: "file capabilities not effective", caps: processCaps{Bounding: netRaw}, fileCaps: fileCaps(false), expected: false},
+		{name: "outside bounding set", caps: processCaps{}, fileCaps: fileCaps(true), expected: false},
+		{name: "no new privileges", caps: processCaps{Bounding: netRaw, NoNewPrivs: true}, fileCaps: fileCaps(true), expected: false},
+		{name: "file capabilities replace ambient", caps: processCaps{Ambient: netRaw, Bounding: netRaw}, fileCaps: make([]byte, 20), expected: false},
+		{name: "malformed attribute", caps: processCaps{Bounding: netRaw}, fileCaps: []byte{1, 0}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.caps.grantsRawSocket(tt.fileCaps); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
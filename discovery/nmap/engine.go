@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+	"github.com/zero-day-ai/sdk/tool"
+	"github.com/zero-day-ai/sdk/toolerr"
+	"google.golang.org/protobuf/proto"
+)
+
+// scanSink receives a scan's events as they happen. Streaming execution
+// forwards them to the client; unary execution discards them and only returns
+// the final response.
+type scanSink interface {
+	progress(percent int, phase, message string) error
+	partial(response *toolspb.NmapResponse) error
+	warning(message, code string)
+	cancelled() <-chan struct{}
+}
+
+// discardSink is the sink for unary execution
+type discardSink struct{}
+
+func (discardSink) progress(int, string, string) error  { return nil }
+func (discardSink) partial(*toolspb.NmapResponse) error { return nil }
+func (discardSink) warning(string, string)              {}
+func (discardSink) cancelled() <-chan struct{}          { return nil }
+
+// scanEvents forwards warnings to the sink and keeps them for the final
+// response. It is safe for concurrent use.
+type scanEvents struct {
+	sink     scanSink
+	mu       sync.Mutex
+	warnings []string
+}
+
+// warn reports a warning and records it on the response
+func (e *scanEvents) warn(message, code string) {
+	e.mu.Lock()
+	e.warnings = append(e.warnings, message)
+	e.mu.Unlock()
+	e.sink.warning(message, code)
+}
+
+// recorded returns the warnings reported so far
+func (e *scanEvents) recorded() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.warnings)
+}
+
+// scanPlan is a validated request ready to run: the nmap command line and
+// what the checks decided on the way
+type scanPlan struct {
+	req        *toolspb.NmapRequest
+	parsed     *nmapArgs
+	scope      scopeResult
+	timeout    time.Duration
+	slowProbes string // warns that fixed probe delays outlast the timeout
+	elevation  string
+	name       string
+	args       []string
+	downgrades []string
+}
+
+// planScan validates a request and builds the nmap command line: structured
+// options and raw args are parsed, checked against the argument policy and
+// capabilities, downgraded if the request opted in, and limited to the scope
+func (t *ToolImpl) planScan(ctx context.Context, input proto.Message) (*scanPlan, error) {
+	// Type assert input to NmapRequest
+	req, ok := input.(*toolspb.NmapRequest)
+	if !ok {
+		return nil, fmt.Errorf("invalid input type: expected *toolspb.NmapRequest, got %T", input)
+	}
+
+	// Validate required fields
+	if len(req.Targets) == 0 {
+		return nil, fmt.Errorf("at least one target is required")
+	}
+
+	if len(req.Args) == 0 && !hasScanOptions(req) {
+		return nil, fmt.Errorf("at least one argument is required")
+	}
+
+	// Translate structured scan options, followed by any raw args
+	scanArgs, err := buildScanArgs(req)
+	if err != nil {
+		return nil, toolerr.New(ToolName, "validate", toolerr.ErrCodeInvalidInput, err.Error()).
+			WithCause(err).
+			WithClass(toolerr.ErrorClassSemantic)
+	}
+
+	// Parse the arguments the way nmap will, so checks see every option
+	parsedArgs, err := parseScanArgs(scanArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject arguments that read or write local files
+	if err := checkArgumentPolicy(parsedArgs); err != nil {
+		return nil, toolerr.New(ToolName, "validate", toolerr.ErrCodeInvalidInput, err.Error()).
+			WithCause(err).
+			WithClass(toolerr.ErrorClassSemantic)
+	}
+
+	// Validate flags against capabilities, rewriting blocked ones if the request
+	// opted in. Privileged options are blocked unless nmap can be elevated to run them.
+	rawCapable := nmapRawCapable()
+	caps := restrictCapabilities(tool.GetCapabilities(ctx, t), parsedArgs, rawCapable)
+	var downgrades []string
+	if req.AutoDowngrade {
+		scanArgs, parsedArgs, downgrades = downgradeArgs(caps, scanArgs, parsedArgs)
+	}
+	if err := checkPrivileges(caps, parsedArgs); err != nil {
+		return nil, err
+	}
+
+	// Bound the scan by the request's timeout
+	timeout, err := effectiveTimeout(ctx, req)
+	if err != nil {
+		return nil, executionError(err.Error(), err)
+	}
+
+	// Drop out-of-scope targets and exclude denied ranges before anything is scanned
+	scope, scanArgs, err := t.enforceScope(ctx, req.Targets, scanArgs, parsedArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build command arguments: -oX - (XML output to stdout) + --stats-every 5s + timeout options + scan args + targets
+	args := []string{"-oX", "-", "--stats-every", "5s"}
+	args = append(args, timeoutArgs(timeout, parsedArgs)...)
+	args = append(args, scanArgs...)
+	args = append(args, scope.Targets...)
+
+	// Run nmap with the elevation the environment allows
+	elevation := chooseElevation(caps, parsedArgs, rawCapable)
+	name, args := elevatedCommand(elevation, args)
+
+	return &scanPlan{
+		req:        req,
+		parsed:     parsedArgs,
+		scope:      scope,
+		timeout:    timeout,
+		slowProbes: scanDelayWarning(timeout, parsedArgs),
+		elevation:  elevation,
+		name:       name,
+		args:       args,
+		downgrades: downgrades,
+	}, nil
+}
+
+// scan is the execution engine behind ExecuteProto and StreamExecuteProto.
+// It plans and runs the scan, reporting hosts, progress and warnings to sink
+// as they happen, and returns the final response. A timeout or cancellation
+// interrupts nmap and returns whatever it finished as a partial result.
+func (t *ToolImpl) scan(ctx context.Context, input proto.Message, sink scanSink) (*toolspb.NmapResponse, error) {
+	startTime := time.Now()
+
+	plan, err := t.planScan(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	events := &scanEvents{sink: sink}
+	for _, warning := range plan.downgrades {
+		events.warn(warning, "privilege_downgrade")
+	}
+	for _, warning := range plan.scope.Warnings {
+		events.warn(warning, "scope")
+	}
+	if plan.slowProbes != "" {
+		events.warn(plan.slowProbes, "scan_delay")
+	}
+
+	// Emit initial progress
+	if err := sink.progress(0, "init", "Starting nmap scan"); err != nil {
+		return nil, fmt.Errorf("failed to emit initial progress: %w", err)
+	}
+
+	// Emit each host as a partial result as soon as nmap flushes it. Partials
+	// carry no discovery result; the graph is built once from the final response.
+	emitHost := func(host NmapHost) {
+		plan.scope.addHostnames(&host)
+		partial := convertToProtoResponse(&NmapRun{Hosts: []NmapHost{host}}, nil, plan.req.Targets, time.Since(startTime).Seconds(), startTime)
+		if err := sink.partial(partial); err != nil {
+			events.warn(fmt.Sprintf("failed to emit partial result: %v", err), "partial_result")
+		}
+	}
+
+	progress := newProgressTracker(plan.parsed, plan.scope.Targets)
+	result, err := runScan(ctx, plan.name, plan.args, plan.timeout, progress, events, emitHost)
+	if err != nil {
+		return nil, err
+	}
+
+	nmapRun := result.run
+	if result.parseErr != nil {
+		switch {
+		case result.partialReason != "":
+			// Interrupted before nmap wrote any XML; report an empty partial scan
+			nmapRun = &NmapRun{Truncated: true}
+		case result.cmdErr != nil:
+			// Unexpected failure, explained by nmap's stderr where possible
+			err := withStderrDiagnostics(result.cmdErr, result.diagnostics)
+			return nil, executionError(fmt.Sprintf("command failed: %v, parse failed: %v", err, result.parseErr), err)
+		default:
+			return nil, toolerr.New(ToolName, "parse", toolerr.ErrCodeParseError, result.parseErr.Error()).
+				WithCause(result.parseErr).
+				WithClass(toolerr.ErrorClassSemantic)
+		}
+	}
+
+	partial := result.partialReason
+	if result.cmdErr != nil && partial == "" {
+		// nmap failed on its own. Fail unless it finished some hosts first,
+		// preferring nmap's own error message over the bare exit status.
+		err := withStderrDiagnostics(result.cmdErr, result.diagnostics)
+		if len(nmapRun.Hosts) == 0 {
+			errMsg := err.Error()
+			if nmapErr := nmapRun.errorMessage(); nmapErr != "" {
+				errMsg = nmapErr
+			}
+			return nil, executionError(errMsg, err)
+		}
+		partial = partialReasonFailed
+		events.warn(fmt.Sprintf("Command exited with error: %v, but partial results available", err), "command_error")
+	} else if partial != "" {
+		events.warn(fmt.Sprintf("Scan stopped (%s), returning partial results", partial), "cancellation")
+	}
+
+	// Interrupted or crashed scans leave the XML unterminated; keep the hosts that completed
+	if nmapRun.Truncated {
+		events.warn(fmt.Sprintf("nmap output was truncated, returning %d complete hosts", len(nmapRun.Hosts)), "truncated_output")
+	}
+
+	// nmap can report a failed run in runstats while still exiting cleanly.
+	// Fail only if nothing was scanned; otherwise the error rides on the response.
+	if errMsg := nmapRun.errorMessage(); errMsg != "" {
+		if len(nmapRun.Hosts) == 0 {
+			nmapErr := withStderrDiagnostics(fmt.Errorf("%w: %s", errNmapReported, errMsg), result.diagnostics)
+			return nil, executionError(nmapErr.Error(), nmapErr)
+		}
+		events.warn(fmt.Sprintf("nmap reported an error: %s", errMsg), "nmap_error")
+	}
+
+	// Name the hosts scanned for hostname targets, as nmap would have
+	for i := range nmapRun.Hosts {
+		plan.scope.addHostnames(&nmapRun.Hosts[i])
+	}
+
+	// Convert to proto types: graph nodes first, then the NmapResponse view
+	discoveryResult := buildDiscoveryResult(nmapRun)
+	scanDuration := time.Since(startTime).Seconds()
+	response := convertToProtoResponse(nmapRun, discoveryResult, plan.req.Targets, scanDuration, startTime)
+	response.Partial = partial != ""
+	response.PartialReason = partial
+	response.Warnings = append(response.Warnings, events.recorded()...)
+	response.Diagnostics = convertDiagnostics(result.diagnostics)
+	response.ElevationStrategy = plan.elevation
+
+	// Emit final progress; the response is complete even if this fails
+	sink.progress(100, "complete", "Scan finished")
+
+	return response, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPlanScan(t *testing.T) {
+	nmapTool := NewTool().(*ToolImpl)
+
+	plan, err := nmapTool.planScan(context.Background(), &toolspb.NmapRequest{
+		Targets: []string{"192.168.1.1"},
+		Args:    []string{"-sT", "-p", "22"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{"-oX", "--stats-every", "--host-timeout", "-sT"} {
+		if !slices.Contains(plan.args, want) {
+			t.Errorf("expected %q in command line %v", want, plan.args)
+		}
+	}
+	if last := plan.args[len(plan.args)-1]; last != "192.168.1.1" {
+		t.Errorf("expected targets last, got %v", plan.args)
+	}
+	if plan.timeout <= 0 {
+		t.Errorf("expected a scan timeout, got %v", plan.timeout)
+	}
+	if !plan.parsed.has("-p") {
+		t.Error("expected the parsed arguments on the plan")
+	}
+}
+
+func TestPlanScanSlowTiming(t *testing.T) {
+	nmapTool := NewTool().(*ToolImpl)
+
+	for _, timing := range []toolspb.TimingTemplate{
+		toolspb.TimingTemplate_TIMING_TEMPLATE_PARANOID,
+		toolspb.TimingTemplate_TIMING_TEMPLATE_SNEAKY,
+	} {
+		plan, err := nmapTool.planScan(context.Background(), &toolspb.NmapRequest{
+			Targets: []string{"192.168.1.1"},
+			Args:    []string{"-sT"},
+			Timing:  timing,
+		})
+		if err != nil {
+			t.Fatalf("expected %v to be accepted, got %v", timing, err)
+		}
+		if plan.slowProbes == "" {
+			t.Errorf("expected a warning that %v outlasts the default timeout", timing)
+		}
+	}
+}
+
+// TestExecutionModesAgree checks that unary and streaming execution reject
+// invalid requests with the same error, as both run the same engine
+func TestExecutionModesAgree(t *testing.T) {
+	nmapTool := NewTool().(*ToolImpl)
+
+	tests := []struct {
+		name  string
+		input proto.Message
+	}{
+		{"wrong input type", &toolspb.NmapResponse{}},
+		{"no targets", &toolspb.NmapRequest{Args: []string{"-sT"}}},
+		{"no args", &toolspb.NmapRequest{Targets: []string{"192.168.1.1"}}},
+		{"unknown option", &toolspb.NmapRequest{Targets: []string{"192.168.1.1"}, Args: []string{"--no-such-option"}}},
+		{"argument policy", &toolspb.NmapRequest{Targets: []string{"192.168.1.1"}, Args: []string{"-sT", "-oN", "/tmp/out"}}},
+		{"positional target", &toolspb.NmapRequest{Targets: []string{"192.168.1.1"}, Args: []string{"-sT", "10.0.0.1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, unaryErr := nmapTool.ExecuteProto(context.Background(), tt.input)
+			if unaryErr == nil {
+				t.Fatal("expected unary execution to fail")
+			}
+
+			stream := newMockToolStream("test-" + tt.name)
+			nmapTool.StreamExecuteProto(context.Background(), tt.input, stream)
+			event := stream.getErrorEvent()
+			if event == nil {
+				t.Fatal("expected streaming execution to fail")
+			}
+			if !event.fatal {
+				t.Error("expected a fatal stream error")
+			}
+			if event.err.Error() != unaryErr.Error() {
+				t.Errorf("expected the same error, got %q (unary) and %q (streaming)", unaryErr, event.err)
+			}
+		})
+	}
+}
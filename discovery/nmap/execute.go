@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Reasons a scan was stopped early and its results are partial
+const (
+	partialReasonTimeout   = "timeout"
+	partialReasonCancelled = "cancelled"
+	partialReasonFailed    = "failed"
+)
+
+// scanResult holds what a finished nmap run left behind
+type scanResult struct {
+	run      *NmapRun
+	parseErr error
+
+	// cmdErr is the command's error, nil if it exited cleanly
+	cmdErr error
+
+	// partialReason is set when the command was interrupted by a timeout or
+	// cancellation rather than exiting on its own
+	partialReason string
+
+	diagnostics []stderrDiagnostic
+}
+
+// runScan runs nmap to completion, bounded by timeout, parsing its XML output
+// and stderr as they are written: each finished host goes to onHost, progress
+// and known stderr conditions to the events' sink. When the timeout expires,
+// ctx is cancelled or the sink asks to cancel, the command's process group is
+// sent SIGINT instead of being killed outright, so nmap can write out the
+// hosts it has finished; it escalates to SIGTERM and SIGKILL per the cancel
+// policy. The error is non-nil only if nmap could not be started.
+func runScan(ctx context.Context, name string, args []string, timeout time.Duration, progress *progressTracker, events *scanEvents, onHost func(NmapHost)) (*scanResult, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	// Setup stdout and stderr pipes
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	// On timeout or cancellation, interrupt nmap's process group so it can flush
+	// its output, escalating to SIGTERM and SIGKILL if it does not exit
+	stopper := newProcessStopper(cmd, loadCancelPolicy(), func(message string) {
+		events.warn(message, "cancellation")
+	}, stdout, stderr)
+
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		return nil, executionError(fmt.Sprintf("failed to start nmap: %v", err), err)
+	}
+
+	// Readers drain stdout and stderr; they must finish before cmd.Wait closes the pipes
+	var readers sync.WaitGroup
+
+	emitProgress := func(p scanProgress) {
+		// Ignore errors to not interrupt scanning
+		events.sink.progress(p.Percent, p.phase(), p.message())
+	}
+
+	// Known conditions nmap reports on stderr are reported as warnings as they occur
+	diagnostics := newStderrClassifier()
+
+	// Parse progress and diagnostics from stderr in goroutine
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if p, ok := progress.statsLine(line); ok {
+				emitProgress(p)
+			} else if diag, ok := diagnostics.line(line); ok {
+				events.sink.warning(diag.Message, diag.Code)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			events.warn(fmt.Sprintf("error reading stderr: %v", err), "stderr_scan")
+		}
+	}()
+
+	emitHost := func(host NmapHost) {
+		progress.hostDone()
+		onHost(host)
+	}
+
+	emitTask := func(event NmapTaskEvent) {
+		emitProgress(progress.taskEvent(event))
+	}
+
+	// Parse stdout incrementally in goroutine
+	result := &scanResult{}
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		result.run, result.parseErr = parseNmapStreamEvents(stdout, emitHost, emitTask)
+		// Keep draining anything left after the parser stopped so nmap never
+		// blocks on a full pipe
+		io.Copy(io.Discard, stdout)
+	}()
+
+	// Handle cancellation in goroutine
+	cancelled := events.sink.cancelled()
+	done := make(chan struct{})
+	var watcher sync.WaitGroup
+	watcher.Add(1)
+	go func() {
+		defer watcher.Done()
+
+		select {
+		case <-cancelled:
+			// User requested cancellation
+			events.warn("Scan cancellation requested", "cancellation")
+
+			stopper.stop()
+
+		case <-ctx.Done():
+			// Context cancelled (timeout or parent cancellation)
+			events.warn(fmt.Sprintf("Context cancelled: %v", ctx.Err()), "context_cancel")
+
+			stopper.stop()
+
+		case <-done:
+			// Scan finished on its own
+		}
+	}()
+
+	// Wait for the output to be fully read, then for the command to complete
+	readers.Wait()
+	result.cmdErr = cmd.Wait()
+	// Stop any escalation before returning, so the reaped process group gets
+	// no further signals and no warning follows the response
+	stopper.done()
+	close(done)
+	watcher.Wait()
+
+	result.diagnostics = diagnostics.diagnostics
+	if result.cmdErr != nil {
+		select {
+		case <-cancelled:
+			result.partialReason = partialReasonCancelled
+		default:
+			result.partialReason = partialReason(ctx)
+		}
+	}
+	return result, nil
+}
+
+// partialReason describes why ctx ended, or returns "" if it has not
+func partialReason(ctx context.Context) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return partialReasonTimeout
+	case ctx.Err() != nil:
+		return partialReasonCancelled
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink records the progress and warnings a scan reports
+type recordingSink struct {
+	discardSink
+	mu       sync.Mutex
+	events   []progressEvent
+	codes    []string
+	cancelCh chan struct{}
+}
+
+func (s *recordingSink) progress(percent int, phase, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, progressEvent{percent, phase, message})
+	return nil
+}
+
+func (s *recordingSink) warning(message, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes = append(s.codes, code)
+}
+
+func (s *recordingSink) cancelled() <-chan struct{} {
+	return s.cancelCh
+}
+
+func (s *recordingSink) hasWarning(code string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunScan(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	// Stand-in for nmap: writes one host, then waits; on SIGINT it closes the document and exits
+	script := `trap 'echo "</nmaprun>"; exit 1' INT
+echo '<nmaprun><host><status state="up"/><address addr="10.0.0.1" addrtype="ipv4"/></host>'
+while :; do sleep 0.1; done`
+
+	run := func(ctx context.Context, sink *recordingSink, script string, timeout time.Duration) (*scanResult, int) {
+		t.Helper()
+		parsed, err := parseNmapArgs(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var mu sync.Mutex
+		hosts := 0
+		result, err := runScan(ctx, "sh", []string{"-c", script}, timeout, newProgressTracker(parsed, nil), &scanEvents{sink: sink}, func(NmapHost) {
+			mu.Lock()
+			defer mu.Unlock()
+			hosts++
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return result, hosts
+	}
+
+	t.Run("completes normally", func(t *testing.T) {
+		result, _ := run(context.Background(), &recordingSink{}, "echo '<nmaprun></nmaprun>'", time.Minute)
+		if result.cmdErr != nil || result.parseErr != nil {
+			t.Fatalf("unexpected errors: %v, %v", result.cmdErr, result.parseErr)
+		}
+		if result.partialReason != "" {
+			t.Errorf("expected no partial reason, got %q", result.partialReason)
+		}
+	})
+
+	t.Run("timeout interrupts and keeps output", func(t *testing.T) {
+		sink := &recordingSink{}
+		result, hosts := run(context.Background(), sink, script, 200*time.Millisecond)
+		if result.cmdErr == nil {
+			t.Fatal("expected error from interrupted command")
+		}
+		if result.partialReason != partialReasonTimeout {
+			t.Errorf("expected reason %q, got %q", partialReasonTimeout, result.partialReason)
+		}
+		if hosts != 1 || result.parseErr != nil || len(result.run.Hosts) != 1 {
+			t.Errorf("expected the completed host to survive the interrupt, got %d hosts (%v)", hosts, result.parseErr)
+		}
+		if !sink.hasWarning("context_cancel") || !sink.hasWarning("cancellation") {
+			t.Errorf("expected the interrupt to be reported, got %v", sink.codes)
+		}
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(200*time.Millisecond, cancel)
+
+		result, hosts := run(ctx, &recordingSink{}, script, time.Minute)
+		if result.partialReason != partialReasonCancelled {
+			t.Errorf("expected reason %q, got %q", partialReasonCancelled, result.partialReason)
+		}
+		if hosts != 1 {
+			t.Errorf("expected output written before cancellation, got %d hosts", hosts)
+		}
+	})
+
+	t.Run("sink cancellation", func(t *testing.T) {
+		sink := &recordingSink{cancelCh: make(chan struct{})}
+		time.AfterFunc(200*time.Millisecond, func() { close(sink.cancelCh) })
+
+		result, _ := run(context.Background(), sink, script, time.Minute)
+		if result.partialReason != partialReasonCancelled {
+			t.Errorf("expected reason %q, got %q", partialReasonCancelled, result.partialReason)
+		}
+	})
+
+	t.Run("failure is not partial", func(t *testing.T) {
+		result, _ := run(context.Background(), &recordingSink{}, "exit 2", time.Minute)
+		if result.cmdErr == nil {
+			t.Fatal("expected error from failing command")
+		}
+		if result.partialReason != "" {
+			t.Errorf("expected no partial reason, got %q", result.partialReason)
+		}
+	})
+
+	t.Run("stderr diagnostics", func(t *testing.T) {
+		sink := &recordingSink{}
+		result, _ := run(context.Background(), sink, `echo 'Failed to resolve "notfound.local".' >&2; echo '<nmaprun></nmaprun>'`, time.Minute)
+		if len(result.diagnostics) != 1 || result.diagnostics[0].Code != diagResolveFailed {
+			t.Errorf("expected a resolve diagnostic, got %+v", result.diagnostics)
+		}
+		if !sink.hasWarning(diagResolveFailed) {
+			t.Errorf("expected the diagnostic to be reported as it occurred, got %v", sink.codes)
+		}
+	})
+
+	t.Run("progress events", func(t *testing.T) {
+		sink := &recordingSink{}
+		progressScript := `echo 'Stats: 0:00:05 elapsed; 1 hosts completed (1 up), 1 undergoing Connect Scan' >&2
+echo '<nmaprun><host><status state="up"/><address addr="10.0.0.1" addrtype="ipv4"/></host>'
+echo '<taskprogress task="Connect Scan" time="1" percent="50.00" remaining="90" etc="2"/>'
+echo '</nmaprun>'`
+		parsed, err := parseNmapArgs([]string{"-sT", "-Pn", "-n"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = runScan(context.Background(), "sh", []string{"-c", progressScript}, time.Minute, newProgressTracker(parsed, []string{"10.0.0.1", "10.0.0.2"}), &scanEvents{sink: sink}, func(NmapHost) {})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		var found bool
+		for _, event := range sink.events {
+			if event.phase != phasePortScan {
+				t.Errorf("expected the port scan phase, got %+v", event)
+			}
+			if strings.Contains(event.message, "ETA 1m30s") {
+				found = true
+				if !strings.Contains(event.message, "1/2 hosts completed") {
+					t.Errorf("expected the host counted once, got %q", event.message)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected a progress event with the task's ETA, got %+v", sink.events)
+		}
+	})
+
+	t.Run("binary not found", func(t *testing.T) {
+		_, err := runScan(context.Background(), "nmap-does-not-exist", nil, time.Minute, newProgressTracker(&nmapArgs{}, nil), &scanEvents{sink: discardSink{}}, func(NmapHost) {})
+		if err == nil {
+			t.Fatal("expected an error starting a missing binary")
+		}
+		if !strings.Contains(err.Error(), "failed to start nmap") {
+			t.Errorf("expected a start failure, got %v", err)
+		}
+	})
+}
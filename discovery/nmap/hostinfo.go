@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/zero-day-ai/sdk/api/gen/graphragpb"
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+// convertHostTiming copies timing, distance, uptime and sequence analysis
+// from the parsed host onto the response host
+func convertHostTiming(nmapHost *toolspb.NmapHost, host NmapHost) {
+	if host.Times != nil {
+		nmapHost.Times = &toolspb.NmapTimes{
+			Srtt:    parseInt32(host.Times.SRTT),
+			Rttvar:  parseInt32(host.Times.RTTVar),
+			Timeout: parseInt32(host.Times.Timeout),
+		}
+	}
+	if host.Distance != nil {
+		nmapHost.Distance = parseInt32(host.Distance.Value)
+	}
+	if host.Uptime != nil {
+		nmapHost.UptimeSeconds = parseInt64(host.Uptime.Seconds)
+		nmapHost.LastBoot = host.Uptime.LastBoot
+	}
+	if host.TCPSequence != nil {
+		nmapHost.TcpSequence = &toolspb.NmapTcpSequence{
+			Index:      parseInt32(host.TCPSequence.Index),
+			Difficulty: host.TCPSequence.Difficulty,
+			Values:     host.TCPSequence.Values,
+		}
+	}
+	nmapHost.IpIdSequence = convertSequence(host.IPIDSequence)
+	nmapHost.TcpTsSequence = convertSequence(host.TCPTSSequence)
+}
+
+// convertSequence converts an IP ID or TCP timestamp sequence classification
+func convertSequence(seq *NmapSequence) *toolspb.NmapSequence {
+	if seq == nil {
+		return nil
+	}
+	return &toolspb.NmapSequence{
+		Class:  seq.Class,
+		Values: seq.Values,
+	}
+}
+
+// applyHostTiming sets the timing, distance, uptime and sequence summary on a
+// Host graph node. Only values nmap actually reported are set.
+func applyHostTiming(hostNode *graphragpb.Host, host NmapHost) {
+	if host.Times != nil && host.Times.SRTT != "" {
+		srtt := parseInt32(host.Times.SRTT)
+		hostNode.Srtt = &srtt
+	}
+	if host.Distance != nil && host.Distance.Value != "" {
+		distance := parseInt32(host.Distance.Value)
+		hostNode.Distance = &distance
+	}
+	if host.Uptime != nil {
+		if host.Uptime.Seconds != "" {
+			uptime := parseInt64(host.Uptime.Seconds)
+			hostNode.UptimeSeconds = &uptime
+		}
+		hostNode.LastBoot = optStr(host.Uptime.LastBoot)
+	}
+	if host.TCPSequence != nil {
+		hostNode.TcpSequenceDifficulty = optStr(host.TCPSequence.Difficulty)
+	}
+	if host.IPIDSequence != nil {
+		hostNode.IpIdSequenceClass = optStr(host.IPIDSequence.Class)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+const hostTimingXML = `<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up"/>
+		<address addr="192.168.1.1" addrtype="ipv4"/>
+		<uptime seconds="1728000" lastboot="Mon Jan  1 00:00:00 2024"/>
+		<distance value="3"/>
+		<tcpsequence index="262" difficulty="Good luck!" values="A1B2C3,D4E5F6"/>
+		<ipidsequence class="All zeros" values="0,0,0"/>
+		<tcptssequence class="1000HZ" values="5F5E100,5F5E164"/>
+		<times srtt="2450" rttvar="1200" to="100000"/>
+	</host>
+	<host>
+		<status state="up"/>
+		<address addr="192.168.1.2" addrtype="ipv4"/>
+	</host>
+</nmaprun>`
+
+func TestConvertHostTiming(t *testing.T) {
+	nmapRun, err := parseNmapRun([]byte(hostTimingXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+	host := response.Hosts[0]
+
+	if host.Times == nil || host.Times.Srtt != 2450 || host.Times.Rttvar != 1200 || host.Times.Timeout != 100000 {
+		t.Errorf("unexpected times: %+v", host.Times)
+	}
+	if host.Distance != 3 {
+		t.Errorf("expected distance=3, got %d", host.Distance)
+	}
+	if host.UptimeSeconds != 1728000 || host.LastBoot != "Mon Jan  1 00:00:00 2024" {
+		t.Errorf("unexpected uptime: %d / %q", host.UptimeSeconds, host.LastBoot)
+	}
+	if host.TcpSequence == nil || host.TcpSequence.Index != 262 || host.TcpSequence.Difficulty != "Good luck!" {
+		t.Errorf("unexpected tcp sequence: %+v", host.TcpSequence)
+	}
+	if host.IpIdSequence == nil || host.IpIdSequence.Class != "All zeros" {
+		t.Errorf("unexpected ip id sequence: %+v", host.IpIdSequence)
+	}
+	if host.TcpTsSequence == nil || host.TcpTsSequence.Class != "1000HZ" {
+		t.Errorf("unexpected tcp timestamp sequence: %+v", host.TcpTsSequence)
+	}
+
+	bare := response.Hosts[1]
+	if bare.Times != nil || bare.TcpSequence != nil || bare.IpIdSequence != nil || bare.Distance != 0 || bare.UptimeSeconds != 0 {
+		t.Errorf("expected no timing data on host without it, got %+v", bare)
+	}
+}
+
+func TestApplyHostTiming(t *testing.T) {
+	result, err := parseOutput([]byte(hostTimingXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	host := result.Hosts[0]
+	if host.Distance == nil || *host.Distance != 3 {
+		t.Errorf("expected distance=3, got %v", host.Distance)
+	}
+	if host.Srtt == nil || *host.Srtt != 2450 {
+		t.Errorf("expected srtt=2450, got %v", host.Srtt)
+	}
+	if host.UptimeSeconds == nil || *host.UptimeSeconds != 1728000 {
+		t.Errorf("expected uptime=1728000, got %v", host.UptimeSeconds)
+	}
+	if host.LastBoot == nil || *host.LastBoot != "Mon Jan  1 00:00:00 2024" {
+		t.Errorf("expected lastboot, got %v", host.LastBoot)
+	}
+	if host.TcpSequenceDifficulty == nil || *host.TcpSequenceDifficulty != "Good luck!" {
+		t.Errorf("expected tcp sequence difficulty, got %v", host.TcpSequenceDifficulty)
+	}
+	if host.IpIdSequenceClass == nil || *host.IpIdSequenceClass != "All zeros" {
+		t.Errorf("expected ip id class, got %v", host.IpIdSequenceClass)
+	}
+
+	bare := result.Hosts[1]
+	if bare.Distance != nil || bare.Srtt != nil || bare.UptimeSeconds != nil || bare.LastBoot != nil {
+		t.Errorf("expected no timing data on host without it")
+	}
+}
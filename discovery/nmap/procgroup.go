@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cancelGracePeriodEnv overrides how long nmap gets to flush its XML after
+// SIGINT before it is sent SIGTERM, as a Go duration (e.g. "30s")
+const cancelGracePeriodEnv = "NMAP_CANCEL_GRACE_PERIOD"
+
+// Cancellation escalation timing. Stopping a scan takes at most the sum of the
+// three periods, however nmap and its helpers respond to the signals.
+const (
+	defaultInterruptGracePeriod = 10 * time.Second
+	maxInterruptGracePeriod     = 2 * time.Minute
+	terminateGracePeriod        = 5 * time.Second
+	killGracePeriod             = 2 * time.Second
+)
+
+// cancelPolicy is how long each cancellation step waits before escalating
+type cancelPolicy struct {
+	Interrupt time.Duration // SIGINT to SIGTERM
+	Terminate time.Duration // SIGTERM to SIGKILL
+	Kill      time.Duration // SIGKILL to giving up on the process group
+}
+
+// bound is the longest cancellation can take
+func (p cancelPolicy) bound() time.Duration {
+	return p.Interrupt + p.Terminate + p.Kill
+}
+
+// loadCancelPolicy returns the cancellation policy, with the interrupt grace
+// period taken from NMAP_CANCEL_GRACE_PERIOD when it is a valid positive
+// duration. Longer values are capped at maxInterruptGracePeriod.
+func loadCancelPolicy() cancelPolicy {
+	policy := cancelPolicy{
+		Interrupt: defaultInterruptGracePeriod,
+		Terminate: terminateGracePeriod,
+		Kill:      killGracePeriod,
+	}
+	if value := os.Getenv(cancelGracePeriodEnv); value != "" {
+		if grace, err := time.ParseDuration(value); err == nil && grace > 0 {
+			policy.Interrupt = min(grace, maxInterruptGracePeriod)
+		}
+	}
+	return policy
+}
+
+// processStopper stops a command and everything it spawned. The command runs
+// in its own process group; stopping sends the group SIGINT so nmap can flush
+// its output, then SIGTERM and finally SIGKILL if it has not exited within the
+// policy's grace periods. Each step is reported through warn.
+//
+// Processes started through sudo run as another user and may not accept our
+// signals directly; sudo relays SIGINT and SIGTERM to them.
+type processStopper struct {
+	cmd    *exec.Cmd
+	policy cancelPolicy
+	warn   func(message string)
+
+	// closers are closed if the process group outlives the kill grace period,
+	// so readers blocked on its pipes return
+	closers []io.Closer
+
+	once       sync.Once
+	escalating sync.WaitGroup
+
+	// mu orders signals against done: once finished is set the process group
+	// may have been reaped and its ID reused, so nothing more is sent
+	mu       sync.Mutex
+	finished bool
+	exited   chan struct{}
+}
+
+// newProcessStopper prepares cmd, before it is started, to run in its own
+// process group and be stopped by escalation when its context is done. The
+// command's WaitDelay is set to the policy's bound.
+func newProcessStopper(cmd *exec.Cmd, policy cancelPolicy, warn func(message string), closers ...io.Closer) *processStopper {
+	s := &processStopper{
+		cmd:     cmd,
+		policy:  policy,
+		warn:    warn,
+		closers: closers,
+		exited:  make(chan struct{}),
+	}
+
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		s.stop()
+		return nil
+	}
+	cmd.WaitDelay = policy.bound()
+	return s
+}
+
+// stop starts the escalation in the background. Only the first call has any
+// effect, and none once done has been called.
+func (s *processStopper) stop() {
+	s.once.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.finished {
+			return
+		}
+		s.escalating.Add(1)
+		go s.escalate()
+	})
+}
+
+// done records that the command has exited and waits for any escalation to
+// return, so no signal or warning follows it; call it once cmd.Wait returns
+func (s *processStopper) done() {
+	s.mu.Lock()
+	s.finished = true
+	close(s.exited)
+	s.mu.Unlock()
+	s.escalating.Wait()
+}
+
+// escalate signals the process group with increasing force until it exits
+func (s *processStopper) escalate() {
+	defer s.escalating.Done()
+
+	steps := []struct {
+		signal os.Signal
+		name   string
+		wait   time.Duration
+	}{
+		{os.Interrupt, "SIGINT", s.policy.Interrupt},
+		{syscall.SIGTERM, "SIGTERM", s.policy.Terminate},
+		{os.Kill, "SIGKILL", s.policy.Kill},
+	}
+
+	for _, step := range steps {
+		if !s.signal(step.signal, step.name, step.wait) {
+			return
+		}
+
+		select {
+		case <-s.exited:
+			return
+		case <-time.After(step.wait):
+		}
+	}
+
+	s.warn(fmt.Sprintf("nmap did not exit within %s of being cancelled, abandoning it", s.policy.bound()))
+	for _, closer := range s.closers {
+		closer.Close()
+	}
+}
+
+// signal reports and sends a signal to the process group, unless the command
+// has already exited. Returns whether it was sent.
+func (s *processStopper) signal(sig os.Signal, name string, wait time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return false
+	}
+
+	s.warn(fmt.Sprintf("sending %s to nmap, waiting up to %s for it to exit", name, wait))
+	if err := signalProcessGroup(s.cmd.Process, sig); err != nil {
+		s.warn(fmt.Sprintf("failed to send %s to nmap: %v", name, err))
+	}
+	return true
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op where process groups are not available
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup signals only the process itself where process groups are
+// not available. Signals other than kill may be unsupported.
+func signalProcessGroup(process *os.Process, sig os.Signal) error {
+	if process == nil {
+		return os.ErrProcessDone
+	}
+	return process.Signal(sig)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadCancelPolicy(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", defaultInterruptGracePeriod},
+		{"30s", 30 * time.Second},
+		{"1h", maxInterruptGracePeriod},
+		{"-5s", defaultInterruptGracePeriod},
+		{"soon", defaultInterruptGracePeriod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(cancelGracePeriodEnv, tt.value)
+
+			policy := loadCancelPolicy()
+			if policy.Interrupt != tt.expected {
+				t.Errorf("expected interrupt grace %s, got %s", tt.expected, policy.Interrupt)
+			}
+			if policy.bound() != tt.expected+terminateGracePeriod+killGracePeriod {
+				t.Errorf("unexpected cancellation bound %s", policy.bound())
+			}
+		})
+	}
+}
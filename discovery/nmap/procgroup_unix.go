@@ -0,0 +1,26 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in a new process group led by itself, so signals
+// reach the helpers it spawns and none are left behind
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalProcessGroup sends sig to every process in the group led by process
+func signalProcessGroup(process *os.Process, sig os.Signal) error {
+	if process == nil {
+		return os.ErrProcessDone
+	}
+	return syscall.Kill(-process.Pid, sig.(syscall.Signal))
+}
@@ -0,0 +1,191 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessStopperEscalates(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	// Stand-in for a stuck nmap: ignores SIGINT and SIGTERM and leaves a helper
+	// process holding its stdout open
+	script := `trap '' INT TERM
+sleep 60 &
+echo started
+while :; do sleep 0.1; done`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Stdout = &stdout
+
+	var mu sync.Mutex
+	var warnings []string
+	stopper := newProcessStopper(cmd, cancelPolicy{
+		Interrupt: 100 * time.Millisecond,
+		Terminate: 100 * time.Millisecond,
+		Kill:      5 * time.Second,
+	}, func(message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, message)
+	})
+	// Wait only returns once the helper has released stdout, i.e. was killed with the group
+	cmd.WaitDelay = 0
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Error("expected error from killed command")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("process group was not killed")
+	}
+	stopper.done()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(warnings) != 3 {
+		t.Fatalf("expected a warning per escalation step, got %v", warnings)
+	}
+	for i, signal := range []string{"SIGINT", "SIGTERM", "SIGKILL"} {
+		if !strings.Contains(warnings[i], signal) {
+			t.Errorf("expected step %d to report %s, got %q", i+1, signal, warnings[i])
+		}
+	}
+}
+
+func TestProcessStopperStopsAtInterrupt(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", "while :; do sleep 0.1; done")
+	var mu sync.Mutex
+	var warnings []string
+	stopper := newProcessStopper(cmd, cancelPolicy{
+		Interrupt: 5 * time.Second,
+		Terminate: 5 * time.Second,
+		Kill:      5 * time.Second,
+	}, func(message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, message)
+	})
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	cmd.Wait()
+	stopper.done()
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected SIGINT to stop the command promptly, took %s", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "SIGINT") {
+		t.Errorf("expected only the SIGINT step, got %v", warnings)
+	}
+}
+
+func TestProcessStopperAfterExit(t *testing.T) {
+	if _, err := exec.LookPath("true"); err != nil {
+		t.Skip("true not available")
+	}
+
+	cmd := exec.CommandContext(context.Background(), "true")
+	var mu sync.Mutex
+	var warnings []string
+	stopper := newProcessStopper(cmd, cancelPolicy{
+		Interrupt: 5 * time.Second,
+		Terminate: 5 * time.Second,
+		Kill:      5 * time.Second,
+	}, func(message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, message)
+	})
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stopper.done()
+
+	// A timeout that fires as the command exits must not signal the reaped group
+	stopper.stop()
+	stopper.escalating.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(warnings) != 0 {
+		t.Errorf("expected no signals after the command exited, got %v", warnings)
+	}
+}
+
+func TestProcessStopperDoneWaitsForEscalation(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", "while :; do sleep 0.1; done")
+	var mu sync.Mutex
+	var warnings []string
+	stopper := newProcessStopper(cmd, cancelPolicy{
+		Interrupt: 5 * time.Second,
+		Terminate: 5 * time.Second,
+		Kill:      5 * time.Second,
+	}, func(message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, message)
+	})
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	time.AfterFunc(100*time.Millisecond, cancel)
+	cmd.Wait()
+	stopper.done()
+
+	// Nothing may be reported once done has returned
+	mu.Lock()
+	count := len(warnings)
+	mu.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(warnings) != count {
+		t.Errorf("expected no warnings after done, got %v", warnings[count:])
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scan phases. nmap runs them in this order for every host group, reporting
+// each as one or more tasks ("ARP Ping Scan", "SYN Stealth Scan", ...).
+const (
+	phaseDiscovery  = "discovery"
+	phaseDNS        = "dns"
+	phasePortScan   = "port_scan"
+	phaseService    = "service_detection"
+	phaseOS         = "os_detection"
+	phaseScripts    = "scripts"
+	phaseTraceroute = "traceroute"
+)
+
+// phaseWeights estimate each phase's share of a scan's run time. They only
+// shape the overall percentage; a phase that does not run is left out.
+var phaseWeights = map[string]int{
+	phaseDiscovery:  10,
+	phaseDNS:        2,
+	phasePortScan:   50,
+	phaseService:    20,
+	phaseOS:         10,
+	phaseScripts:    15,
+	phaseTraceroute: 5,
+}
+
+// progressRegex matches nmap --stats-every percentage output
+// Example: "Stats: 25.00% done"
+var progressRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)%\s+done`)
+
+// statsRegex matches nmap's periodic status line
+// Example: "Stats: 0:00:05 elapsed; 2 hosts completed (1 up), 1 undergoing SYN Stealth Scan"
+var statsRegex = regexp.MustCompile(`^Stats: \S+ elapsed; (\d+) hosts? completed \(\d+ up\), (\d+) undergoing (.+)$`)
+
+// timingRegex matches nmap's per-task completion estimate
+// Example: "SYN Stealth Scan Timing: About 45.20% done; ETC: 12:34 (0:00:06 remaining)"
+var timingRegex = regexp.MustCompile(`^(.+?) Timing: About (\d+(?:\.\d+)?)% done(?:; ETC: \S+ \((\d+):(\d+):(\d+) remaining\))?`)
+
+// maxCountedHosts caps the estimated number of hosts in a single target so
+// large IPv6 prefixes do not overflow the count
+const maxCountedHosts = 1 << 24
+
+// scanProgress is a snapshot of a running scan's progress
+type scanProgress struct {
+	Task        string        // nmap's name for the current task, e.g. "Service scan"
+	Phase       string        // phase the task belongs to
+	Percent     int           // overall percent across all phases
+	TaskPercent float64       // percent of the current task
+	Remaining   time.Duration // nmap's estimate for the current task, 0 if unknown
+	HostsDone   int
+	HostsTotal  int // estimated from the targets, 0 if unknown
+}
+
+// phase names the phase for a stream progress event; tasks that belong to no
+// phase report as "scanning"
+func (p scanProgress) phase() string {
+	if p.Phase == "" {
+		return "scanning"
+	}
+	return p.Phase
+}
+
+// message formats the progress for a stream progress event: the task, its
+// ETA and the hosts completed
+func (p scanProgress) message() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %.0f%% of phase", p.Task, p.TaskPercent)
+	if p.Remaining > 0 {
+		fmt.Fprintf(&b, ", ETA %s", p.Remaining)
+	}
+	if p.HostsTotal > 0 {
+		fmt.Fprintf(&b, ", %d/%d hosts completed", p.HostsDone, p.HostsTotal)
+	} else if p.HostsDone > 0 {
+		fmt.Fprintf(&b, ", %d hosts completed", p.HostsDone)
+	}
+	return b.String()
+}
+
+// progressTracker combines nmap's task events and status lines into overall
+// progress. Phases are weighted by phaseWeights over the phases the arguments
+// will run, so finishing host discovery does not read as a finished scan, and
+// the overall percentage never goes backwards when a later host group starts
+// over with discovery. It is safe for concurrent use.
+type progressTracker struct {
+	mu          sync.Mutex
+	phases      []string
+	totalWeight int
+	current     scanProgress
+
+	// Hosts completed per nmap's status lines and hosts seen in its XML
+	// output. Both count the same hosts, so the larger one is reported.
+	statsDone int
+	hostsSeen int
+}
+
+// newProgressTracker creates a tracker for a scan with the given arguments and targets
+func newProgressTracker(parsed *nmapArgs, targets []string) *progressTracker {
+	p := &progressTracker{phases: plannedPhases(parsed)}
+	for _, phase := range p.phases {
+		p.totalWeight += phaseWeights[phase]
+	}
+	p.current.HostsTotal = countTargetHosts(targets)
+	return p
+}
+
+// taskEvent records a taskbegin, taskprogress or taskend event
+func (p *progressTracker) taskEvent(event NmapTaskEvent) scanProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch event.XMLName.Local {
+	case "taskbegin":
+		p.setTask(event.Task, 0, 0)
+	case "taskprogress":
+		p.setTask(event.Task, event.Percent, time.Duration(event.Remaining)*time.Second)
+	case "taskend":
+		p.setTask(event.Task, 100, 0)
+	}
+	return p.current
+}
+
+// statsLine records an nmap status line from stderr. Returns false if the line
+// carries no progress information.
+func (p *progressTracker) statsLine(line string) (scanProgress, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if matches := statsRegex.FindStringSubmatch(line); matches != nil {
+		done, _ := strconv.Atoi(matches[1])
+		undergoing, _ := strconv.Atoi(matches[2])
+		p.statsDone = max(p.statsDone, done)
+		p.updateHosts()
+		p.current.HostsTotal = max(p.current.HostsTotal, done+undergoing)
+		if matches[3] != p.current.Task {
+			p.setTask(matches[3], 0, 0)
+		}
+		return p.current, true
+	}
+
+	if matches := timingRegex.FindStringSubmatch(line); matches != nil {
+		percent, _ := strconv.ParseFloat(matches[2], 64)
+		var remaining time.Duration
+		if matches[3] != "" {
+			hours, _ := strconv.Atoi(matches[3])
+			minutes, _ := strconv.Atoi(matches[4])
+			seconds, _ := strconv.Atoi(matches[5])
+			remaining = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+		}
+		p.setTask(matches[1], percent, remaining)
+		return p.current, true
+	}
+
+	if matches := progressRegex.FindStringSubmatch(line); len(matches) > 1 {
+		percent, _ := strconv.ParseFloat(matches[1], 64)
+		p.setTask(p.current.Task, percent, 0)
+		return p.current, true
+	}
+
+	return p.current, false
+}
+
+// updateHosts recomputes the hosts completed from both counts
+func (p *progressTracker) updateHosts() {
+	p.current.HostsDone = max(p.statsDone, p.hostsSeen)
+	p.current.HostsTotal = max(p.current.HostsTotal, p.current.HostsDone)
+	if p.current.HostsTotal > 0 {
+		p.raise(p.current.HostsDone * 100 / p.current.HostsTotal)
+	}
+}
+
+// hostDone records one more host in nmap's XML output
+func (p *progressTracker) hostDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hostsSeen++
+	p.updateHosts()
+}
+
+// setTask updates the current task and recomputes the overall percentage
+func (p *progressTracker) setTask(task string, percent float64, remaining time.Duration) {
+	if task == "" {
+		task = "scanning"
+	}
+	p.current.Task = task
+	p.current.Phase = taskPhase(task)
+	p.current.TaskPercent = math.Min(math.Max(percent, 0), 100)
+	p.current.Remaining = remaining
+
+	if p.totalWeight == 0 {
+		return
+	}
+	done := 0
+	for _, phase := range p.phases {
+		if phase == p.current.Phase {
+			weighted := float64(done) + float64(phaseWeights[phase])*p.current.TaskPercent/100
+			p.raise(int(weighted * 100 / float64(p.totalWeight)))
+			return
+		}
+		done += phaseWeights[phase]
+	}
+}
+
+// raise moves the overall percentage up to percent. It stays below 100 until
+// the scan completes, which is reported separately.
+func (p *progressTracker) raise(percent int) {
+	p.current.Percent = max(p.current.Percent, min(percent, 99))
+}
+
+// plannedPhases returns the phases nmap will run for the parsed arguments, in order
+func plannedPhases(parsed *nmapArgs) []string {
+	if parsed.has("-sL") {
+		// List scan only resolves names
+		return []string{phaseDNS}
+	}
+
+	var phases []string
+	if !parsed.has("-Pn") {
+		phases = append(phases, phaseDiscovery)
+	}
+	if !parsed.has("-n") {
+		phases = append(phases, phaseDNS)
+	}
+	if !parsed.has("-sn") {
+		phases = append(phases, phasePortScan)
+	}
+	if parsed.has("-sV") {
+		phases = append(phases, phaseService)
+	}
+	if parsed.has("-O") {
+		phases = append(phases, phaseOS)
+	}
+	if parsed.has("--traceroute") {
+		phases = append(phases, phaseTraceroute)
+	}
+	if parsed.has("-sC") || parsed.has("--script") {
+		phases = append(phases, phaseScripts)
+	}
+	return phases
+}
+
+// taskPhase maps an nmap task name to its phase, or "" if it is not recognised
+func taskPhase(task string) string {
+	switch {
+	case task == "Script Pre-scanning":
+		// Runs once before any host group; too early to place on the scale
+		return ""
+	case strings.Contains(task, "NSE") || strings.HasPrefix(task, "Script"):
+		return phaseScripts
+	case strings.Contains(task, "Ping Scan"):
+		return phaseDiscovery
+	case strings.Contains(task, "DNS resolution"):
+		return phaseDNS
+	case task == "Service scan":
+		return phaseService
+	case task == "OS detection":
+		return phaseOS
+	case task == "Traceroute":
+		return phaseTraceroute
+	case strings.HasSuffix(task, "Scan"):
+		return phasePortScan
+	default:
+		return ""
+	}
+}
+
+// countTargetHosts estimates how many hosts the targets cover: one per address
+// or hostname, the size of each CIDR and the product of each octet range
+func countTargetHosts(targets []string) int {
+	total := 0
+	for _, target := range targets {
+		total += min(countTarget(target), maxCountedHosts)
+	}
+	return total
+}
+
+// countTarget estimates the number of hosts in a single target
+func countTarget(target string) int {
+	if prefix, err := netip.ParsePrefix(target); err == nil {
+		hostBits := prefix.Addr().BitLen() - prefix.Bits()
+		if hostBits >= 24 {
+			return maxCountedHosts
+		}
+		return 1 << hostBits
+	}
+
+	// Octet ranges such as 192.168.1-2.1-50 or 10.0.0.1,5
+	octets := strings.Split(target, ".")
+	if len(octets) != 4 || !strings.ContainsAny(target, "-,") {
+		return 1
+	}
+	count := 1
+	for _, octet := range octets {
+		n := 0
+		for _, part := range strings.Split(octet, ",") {
+			lo, hi, isRange := strings.Cut(part, "-")
+			if !isRange {
+				n++
+				continue
+			}
+			from, err1 := strconv.Atoi(lo)
+			to, err2 := strconv.Atoi(hi)
+			if err1 != nil || err2 != nil || to < from {
+				return 1
+			}
+			n += to - from + 1
+		}
+		count *= n
+	}
+	return count
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func taskEvent(kind, task string, percent float64, remaining int64) NmapTaskEvent {
+	return NmapTaskEvent{XMLName: xml.Name{Local: kind}, Task: task, Percent: percent, Remaining: remaining}
+}
+
+func TestProgressTrackerPhases(t *testing.T) {
+	parsed, err := parseNmapArgs([]string{"-sT", "-sV"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracker := newProgressTracker(parsed, []string{"192.168.1.0/30"})
+
+	events := []NmapTaskEvent{
+		taskEvent("taskbegin", "Ping Scan", 0, 0),
+		taskEvent("taskend", "Ping Scan", 0, 0),
+		taskEvent("taskbegin", "Parallel DNS resolution of 4 hosts.", 0, 0),
+		taskEvent("taskend", "Parallel DNS resolution of 4 hosts.", 0, 0),
+		taskEvent("taskbegin", "Connect Scan", 0, 0),
+		taskEvent("taskprogress", "Connect Scan", 50, 30),
+		taskEvent("taskend", "Connect Scan", 0, 0),
+		taskEvent("taskbegin", "Service scan", 0, 0),
+		taskEvent("taskprogress", "Service scan", 50, 10),
+		taskEvent("taskend", "Service scan", 0, 0),
+	}
+
+	var percents []int
+	for _, event := range events {
+		percents = append(percents, tracker.taskEvent(event).Percent)
+	}
+
+	for i := 1; i < len(percents); i++ {
+		if percents[i] < percents[i-1] {
+			t.Fatalf("overall progress went backwards: %v", percents)
+		}
+	}
+	if percents[1] >= 50 {
+		t.Errorf("finishing host discovery should not read as most of the scan, got %d%%", percents[1])
+	}
+	if percents[5] <= percents[4] {
+		t.Errorf("expected port scan progress to raise overall progress, got %v", percents)
+	}
+	if last := percents[len(percents)-1]; last != 99 {
+		t.Errorf("expected 99%% before completion, got %d%%", last)
+	}
+
+	progress := tracker.taskEvent(taskEvent("taskprogress", "Service scan", 25, 90))
+	if progress.Phase != phaseService || progress.Remaining != 90*time.Second {
+		t.Errorf("unexpected progress snapshot: %+v", progress)
+	}
+	if progress.HostsTotal != 4 {
+		t.Errorf("expected 4 hosts from the target, got %d", progress.HostsTotal)
+	}
+}
+
+func TestProgressTrackerLaterHostGroup(t *testing.T) {
+	parsed, err := parseNmapArgs([]string{"-sT"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracker := newProgressTracker(parsed, nil)
+
+	tracker.taskEvent(taskEvent("taskend", "Connect Scan", 0, 0))
+	before := tracker.taskEvent(taskEvent("taskprogress", "Connect Scan", 100, 0)).Percent
+
+	// The next host group starts over with discovery
+	after := tracker.taskEvent(taskEvent("taskbegin", "Ping Scan", 0, 0)).Percent
+	if after < before {
+		t.Errorf("expected progress to hold at %d%%, got %d%%", before, after)
+	}
+}
+
+func TestProgressTrackerStatsLines(t *testing.T) {
+	parsed, err := parseNmapArgs([]string{"-sS"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracker := newProgressTracker(parsed, []string{"10.0.0.1", "10.0.0.2"})
+
+	progress, ok := tracker.statsLine("Stats: 0:00:05 elapsed; 1 hosts completed (1 up), 1 undergoing SYN Stealth Scan")
+	if !ok {
+		t.Fatal("expected stats line to be recognised")
+	}
+	if progress.Task != "SYN Stealth Scan" || progress.HostsDone != 1 || progress.HostsTotal != 2 {
+		t.Errorf("unexpected progress from stats line: %+v", progress)
+	}
+	if progress.Percent < 50 {
+		t.Errorf("expected half the hosts to count as half the scan, got %d%%", progress.Percent)
+	}
+
+	progress, ok = tracker.statsLine("SYN Stealth Scan Timing: About 45.20% done; ETC: 12:34 (0:01:06 remaining)")
+	if !ok {
+		t.Fatal("expected timing line to be recognised")
+	}
+	if progress.TaskPercent != 45.2 || progress.Remaining != 66*time.Second {
+		t.Errorf("unexpected progress from timing line: %+v", progress)
+	}
+
+	message := progress.message()
+	for _, want := range []string{"SYN Stealth Scan", "45%", "ETA 1m6s", "1/2 hosts completed"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("expected message %q to contain %q", message, want)
+		}
+	}
+
+	if _, ok := tracker.statsLine("Warning: 10.0.0.1 giving up on port because retransmission cap hit (10)."); ok {
+		t.Error("expected unrelated line to be ignored")
+	}
+}
+
+func TestProgressTrackerHostCounts(t *testing.T) {
+	parsed, err := parseNmapArgs([]string{"-sT"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracker := newProgressTracker(parsed, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"})
+
+	// The status line and the XML report the same finished host
+	tracker.statsLine("Stats: 0:00:05 elapsed; 1 hosts completed (1 up), 3 undergoing Connect Scan")
+	tracker.hostDone()
+	progress, _ := tracker.statsLine("Connect Scan Timing: About 10.00% done")
+	if progress.HostsDone != 1 {
+		t.Errorf("expected the host to be counted once, got %d", progress.HostsDone)
+	}
+
+	// The XML runs ahead of the next status line
+	tracker.hostDone()
+	tracker.hostDone()
+	progress, _ = tracker.statsLine("Stats: 0:00:10 elapsed; 2 hosts completed (2 up), 2 undergoing Connect Scan")
+	if progress.HostsDone != 3 || progress.HostsTotal != 4 {
+		t.Errorf("expected 3/4 hosts, got %d/%d", progress.HostsDone, progress.HostsTotal)
+	}
+
+	// Down hosts only appear in the status line
+	progress, _ = tracker.statsLine("Stats: 0:00:15 elapsed; 4 hosts completed (3 up), 0 undergoing Connect Scan")
+	if progress.HostsDone != 4 {
+		t.Errorf("expected 4 hosts, got %d", progress.HostsDone)
+	}
+}
+
+func TestScanProgressPhase(t *testing.T) {
+	if phase := (scanProgress{Task: "Service scan", Phase: phaseService}).phase(); phase != phaseService {
+		t.Errorf("expected %q, got %q", phaseService, phase)
+	}
+	if phase := (scanProgress{Task: "Script Pre-scanning"}).phase(); phase != "scanning" {
+		t.Errorf("expected tasks outside any phase to report as scanning, got %q", phase)
+	}
+}
+
+func TestPlannedPhases(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"-sn"}, []string{phaseDiscovery, phaseDNS}},
+		{[]string{"-sT", "-Pn", "-n"}, []string{phasePortScan}},
+		{[]string{"-A"}, []string{phaseDiscovery, phaseDNS, phasePortScan, phaseService, phaseOS, phaseTraceroute, phaseScripts}},
+		{[]string{"-sL"}, []string{phaseDNS}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := plannedPhases(parsed); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTaskPhase(t *testing.T) {
+	tests := map[string]string{
+		"ARP Ping Scan":                      phaseDiscovery,
+		"Ping Scan":                          phaseDiscovery,
+		"Parallel DNS resolution of 1 host.": phaseDNS,
+		"SYN Stealth Scan":                   phasePortScan,
+		"UDP Scan":                           phasePortScan,
+		"Service scan":                       phaseService,
+		"OS detection":                       phaseOS,
+		"Traceroute":                         phaseTraceroute,
+		"NSE":                                phaseScripts,
+		"Script Pre-scanning":                "",
+		"Something else":                     "",
+	}
+
+	for task, expected := range tests {
+		if got := taskPhase(task); got != expected {
+			t.Errorf("taskPhase(%q) = %q, expected %q", task, got, expected)
+		}
+	}
+}
+
+func TestCountTargetHosts(t *testing.T) {
+	tests := []struct {
+		targets  []string
+		expected int
+	}{
+		{[]string{"192.168.1.1"}, 1},
+		{[]string{"scanme.nmap.org"}, 1},
+		{[]string{"192.168.1.0/24"}, 256},
+		{[]string{"192.168.1.1-10", "10.0.0.1"}, 11},
+		{[]string{"192.168.1-2.1,5"}, 4},
+		{[]string{"2001:db8::/32"}, maxCountedHosts},
+	}
+
+	for _, tt := range tests {
+		if got := countTargetHosts(tt.targets); got != tt.expected {
+			t.Errorf("countTargetHosts(%v) = %d, expected %d", tt.targets, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+// errorMessage returns nmap's error message if runstats reports a failed run,
+// or an empty string if the run succeeded or never reached runstats
+func (r *NmapRun) errorMessage() string {
+	finished := r.RunStats.Finished
+	if finished.Exit != "error" {
+		return ""
+	}
+	if finished.ErrorMsg != "" {
+		return finished.ErrorMsg
+	}
+	return "nmap exited with an error"
+}
+
+// applyRunInfo copies nmap's run metadata and parse completeness onto the
+// response. nmap's own start time, end time, elapsed time and host counts
+// replace the locally measured values when present; truncated output without
+// runstats keeps the local ones.
+func applyRunInfo(response *toolspb.NmapResponse, nmapRun *NmapRun) {
+	response.NmapVersion = nmapRun.Version
+	response.CommandLine = nmapRun.Args
+	response.XmlOutputVersion = nmapRun.XMLOutputVersion
+
+	for _, info := range nmapRun.ScanInfo {
+		response.ScanInfo = append(response.ScanInfo, &toolspb.NmapScanInfo{
+			Type:        info.Type,
+			Protocol:    info.Protocol,
+			NumServices: parseInt32(info.NumServices),
+			Services:    info.Services,
+		})
+	}
+
+	finished := nmapRun.RunStats.Finished
+	response.ExitStatus = finished.Exit
+	response.Summary = finished.Summary
+	response.ErrorMessage = nmapRun.errorMessage()
+	response.Truncated = nmapRun.Truncated
+	response.CompleteHosts = int32(len(nmapRun.Hosts))
+
+	if start := parseInt64(nmapRun.Start); start > 0 {
+		response.StartTime = start
+	}
+	if end := parseInt64(finished.Time); end > 0 {
+		response.EndTime = end
+	}
+	if elapsed, err := strconv.ParseFloat(finished.Elapsed, 64); err == nil && elapsed > 0 {
+		response.ScanDuration = elapsed
+	}
+
+	if hosts := nmapRun.RunStats.Hosts; hosts.Total != "" {
+		response.TotalHosts = parseInt32(hosts.Total)
+		response.HostsUp = parseInt32(hosts.Up)
+		response.HostsDown = parseInt32(hosts.Down)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyRunInfo(t *testing.T) {
+	runXML := []byte(`<?xml version="1.0"?>
+<nmaprun scanner="nmap" args="nmap -oX - -sS -sU -p T:22,U:53 10.0.0.0/30" start="1700000000" startstr="Tue Nov 14 22:13:20 2023" version="7.94" xmloutputversion="1.05">
+	<scaninfo type="syn" protocol="tcp" numservices="1" services="22"/>
+	<scaninfo type="udp" protocol="udp" numservices="1" services="53"/>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.0.1" addrtype="ipv4"/>
+	</host>
+	<runstats>
+		<finished time="1700000042" timestr="Tue Nov 14 22:14:02 2023" summary="Nmap done; 4 IP addresses (1 host up) scanned in 42.50 seconds" elapsed="42.50" exit="success"/>
+		<hosts up="1" down="3" total="4"/>
+	</runstats>
+</nmaprun>`)
+
+	nmapRun, err := parseNmapRun(runXML)
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	localStart := time.Unix(1800000000, 0)
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 99, localStart)
+
+	if response.NmapVersion != "7.94" || response.XmlOutputVersion != "1.05" {
+		t.Errorf("unexpected version metadata: %q / %q", response.NmapVersion, response.XmlOutputVersion)
+	}
+	if response.CommandLine != "nmap -oX - -sS -sU -p T:22,U:53 10.0.0.0/30" {
+		t.Errorf("unexpected command line: %q", response.CommandLine)
+	}
+	if len(response.ScanInfo) != 2 || response.ScanInfo[1].Type != "udp" || response.ScanInfo[1].NumServices != 1 {
+		t.Errorf("unexpected scan info: %+v", response.ScanInfo)
+	}
+	if response.StartTime != 1700000000 || response.EndTime != 1700000042 || response.ScanDuration != 42.5 {
+		t.Errorf("expected nmap timing, got start=%d end=%d duration=%v", response.StartTime, response.EndTime, response.ScanDuration)
+	}
+	if response.TotalHosts != 4 || response.HostsUp != 1 || response.HostsDown != 3 {
+		t.Errorf("expected nmap host counts 4/1/3, got %d/%d/%d", response.TotalHosts, response.HostsUp, response.HostsDown)
+	}
+	if response.ExitStatus != "success" || response.ErrorMessage != "" {
+		t.Errorf("expected success without error, got %q / %q", response.ExitStatus, response.ErrorMessage)
+	}
+}
+
+func TestApplyRunInfoFallback(t *testing.T) {
+	// Output without runstats (e.g. an interrupted scan) keeps locally measured values
+	nmapRun, err := parseNmapRun([]byte(`<nmaprun><host><status state="up"/><address addr="10.0.0.1" addrtype="ipv4"/></host></nmaprun>`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	localStart := time.Unix(1800000000, 0)
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 12.5, localStart)
+
+	if response.StartTime != 1800000000 || response.ScanDuration != 12.5 {
+		t.Errorf("expected local timing, got start=%d duration=%v", response.StartTime, response.ScanDuration)
+	}
+	if response.TotalHosts != 1 || response.HostsUp != 1 {
+		t.Errorf("expected counted hosts 1/1, got %d/%d", response.TotalHosts, response.HostsUp)
+	}
+}
+
+func TestRunErrorMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		xml      string
+		expected string
+	}{
+		{
+			name:     "error with message",
+			xml:      `<nmaprun><runstats><finished exit="error" errormsg="Failed to open device eth9"/></runstats></nmaprun>`,
+			expected: "Failed to open device eth9",
+		},
+		{
+			name:     "error without message",
+			xml:      `<nmaprun><runstats><finished exit="error"/></runstats></nmaprun>`,
+			expected: "nmap exited with an error",
+		},
+		{
+			name:     "success",
+			xml:      `<nmaprun><runstats><finished exit="success"/></runstats></nmaprun>`,
+			expected: "",
+		},
+		{
+			name:     "no runstats",
+			xml:      `<nmaprun></nmaprun>`,
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nmapRun, err := parseNmapRun([]byte(tt.xml))
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			if got := nmapRun.errorMessage(); got != tt.expected {
+				t.Errorf("errorMessage() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
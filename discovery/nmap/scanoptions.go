@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+// scanTypeFlags maps the scanType enum to nmap's scan technique flags
+var scanTypeFlags = map[toolspb.ScanType]string{
+	toolspb.ScanType_SCAN_TYPE_PING:    "-sn",
+	toolspb.ScanType_SCAN_TYPE_SYN:     "-sS",
+	toolspb.ScanType_SCAN_TYPE_CONNECT: "-sT",
+	toolspb.ScanType_SCAN_TYPE_UDP:     "-sU",
+	toolspb.ScanType_SCAN_TYPE_ACK:     "-sA",
+	toolspb.ScanType_SCAN_TYPE_WINDOW:  "-sW",
+	toolspb.ScanType_SCAN_TYPE_MAIMON:  "-sM",
+}
+
+// timingFlags maps the timing enum to nmap's timing templates
+var timingFlags = map[toolspb.TimingTemplate]string{
+	toolspb.TimingTemplate_TIMING_TEMPLATE_PARANOID:   "-T0",
+	toolspb.TimingTemplate_TIMING_TEMPLATE_SNEAKY:     "-T1",
+	toolspb.TimingTemplate_TIMING_TEMPLATE_POLITE:     "-T2",
+	toolspb.TimingTemplate_TIMING_TEMPLATE_NORMAL:     "-T3",
+	toolspb.TimingTemplate_TIMING_TEMPLATE_AGGRESSIVE: "-T4",
+	toolspb.TimingTemplate_TIMING_TEMPLATE_INSANE:     "-T5",
+}
+
+// portSpecRegex matches nmap port specifications built from numbers and ranges,
+// optionally protocol-qualified: "22,80,443", "1-1000", "-", "U:53,T:1-1024"
+var portSpecRegex = regexp.MustCompile(`^(?:[TUSP]:)?(?:\d+(?:-\d*)?|-\d*)(?:,(?:[TUSP]:)?(?:\d+(?:-\d*)?|-\d+))*$`)
+
+// scriptNameRegex matches NSE script names, categories and wildcards such as
+// "http-title", "default" or "smb-vuln-*". Paths are deliberately excluded.
+var scriptNameRegex = regexp.MustCompile(`^[A-Za-z0-9*][A-Za-z0-9_*-]*$`)
+
+// hasScanOptions reports whether any structured scan option is set
+func hasScanOptions(req *toolspb.NmapRequest) bool {
+	return req.ScanType != toolspb.ScanType_SCAN_TYPE_UNSPECIFIED ||
+		req.Timing != toolspb.TimingTemplate_TIMING_TEMPLATE_UNSPECIFIED ||
+		req.Ports != "" ||
+		req.TopPorts != 0 ||
+		req.ServiceDetection ||
+		req.OsDetection ||
+		len(req.Scripts) > 0
+}
+
+// buildScanArgs builds the nmap arguments for a request. Structured options are
+// translated first; raw Args are appended unchanged as an escape hatch for
+// anything the typed fields do not cover.
+func buildScanArgs(req *toolspb.NmapRequest) ([]string, error) {
+	var args []string
+
+	if req.ScanType != toolspb.ScanType_SCAN_TYPE_UNSPECIFIED {
+		flag, ok := scanTypeFlags[req.ScanType]
+		if !ok {
+			return nil, fmt.Errorf("unsupported scan type: %s", req.ScanType)
+		}
+		args = append(args, flag)
+	}
+
+	if req.Timing != toolspb.TimingTemplate_TIMING_TEMPLATE_UNSPECIFIED {
+		flag, ok := timingFlags[req.Timing]
+		if !ok {
+			return nil, fmt.Errorf("unsupported timing template: %s", req.Timing)
+		}
+		args = append(args, flag)
+	}
+
+	// Ping scans skip port scanning entirely, so port and detection options make no sense
+	if req.ScanType == toolspb.ScanType_SCAN_TYPE_PING {
+		if req.Ports != "" || req.TopPorts != 0 {
+			return nil, fmt.Errorf("ports cannot be combined with a ping scan")
+		}
+		if req.ServiceDetection || req.OsDetection {
+			return nil, fmt.Errorf("service and OS detection cannot be combined with a ping scan")
+		}
+	}
+
+	if req.Ports != "" && req.TopPorts != 0 {
+		return nil, fmt.Errorf("ports and top_ports are mutually exclusive")
+	}
+	if req.Ports != "" {
+		ports := strings.ReplaceAll(req.Ports, " ", "")
+		if !portSpecRegex.MatchString(ports) {
+			return nil, fmt.Errorf("invalid port specification: %q", req.Ports)
+		}
+		args = append(args, "-p", ports)
+	}
+	if req.TopPorts < 0 {
+		return nil, fmt.Errorf("top_ports must be positive, got %d", req.TopPorts)
+	}
+	if req.TopPorts > 0 {
+		args = append(args, "--top-ports", strconv.Itoa(int(req.TopPorts)))
+	}
+
+	if req.ServiceDetection {
+		args = append(args, "-sV")
+	}
+	if req.OsDetection {
+		args = append(args, "-O")
+	}
+
+	if len(req.Scripts) > 0 {
+		for _, script := range req.Scripts {
+			if !scriptNameRegex.MatchString(script) {
+				return nil, fmt.Errorf("invalid script name: %q", script)
+			}
+		}
+		args = append(args, "--script", strings.Join(req.Scripts, ","))
+	}
+
+	return append(args, req.Args...), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+func TestBuildScanArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *toolspb.NmapRequest
+		expected []string
+	}{
+		{
+			name:     "raw args only",
+			request:  &toolspb.NmapRequest{Args: []string{"-sT", "-p", "22"}},
+			expected: []string{"-sT", "-p", "22"},
+		},
+		{
+			name: "scan type, timing and ports",
+			request: &toolspb.NmapRequest{
+				ScanType: toolspb.ScanType_SCAN_TYPE_CONNECT,
+				Timing:   toolspb.TimingTemplate_TIMING_TEMPLATE_AGGRESSIVE,
+				Ports:    "22,80,443",
+			},
+			expected: []string{"-sT", "-T4", "-p", "22,80,443"},
+		},
+		{
+			name: "ping scan",
+			request: &toolspb.NmapRequest{
+				ScanType: toolspb.ScanType_SCAN_TYPE_PING,
+				Timing:   toolspb.TimingTemplate_TIMING_TEMPLATE_PARANOID,
+			},
+			expected: []string{"-sn", "-T0"},
+		},
+		{
+			name: "top ports with detection and scripts",
+			request: &toolspb.NmapRequest{
+				ScanType:         toolspb.ScanType_SCAN_TYPE_SYN,
+				TopPorts:         100,
+				ServiceDetection: true,
+				OsDetection:      true,
+				Scripts:          []string{"default", "http-title", "smb-vuln-*"},
+			},
+			expected: []string{"-sS", "--top-ports", "100", "-sV", "-O", "--script", "default,http-title,smb-vuln-*"},
+		},
+		{
+			name: "raw args appended after structured options",
+			request: &toolspb.NmapRequest{
+				ScanType: toolspb.ScanType_SCAN_TYPE_UDP,
+				Ports:    "U:53, U:161",
+				Args:     []string{"--reason"},
+			},
+			expected: []string{"-sU", "-p", "U:53,U:161", "--reason"},
+		},
+		{
+			name:     "all ports",
+			request:  &toolspb.NmapRequest{Ports: "-"},
+			expected: []string{"-p", "-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildScanArgs(tt.request)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBuildScanArgsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *toolspb.NmapRequest
+	}{
+		{
+			name:    "unknown scan type",
+			request: &toolspb.NmapRequest{ScanType: toolspb.ScanType(99)},
+		},
+		{
+			name:    "unknown timing template",
+			request: &toolspb.NmapRequest{Timing: toolspb.TimingTemplate(99)},
+		},
+		{
+			name:    "ports and top ports",
+			request: &toolspb.NmapRequest{Ports: "22", TopPorts: 100},
+		},
+		{
+			name:    "negative top ports",
+			request: &toolspb.NmapRequest{TopPorts: -1},
+		},
+		{
+			name:    "malformed port spec",
+			request: &toolspb.NmapRequest{Ports: "22;rm -rf /"},
+		},
+		{
+			name:    "ping scan with ports",
+			request: &toolspb.NmapRequest{ScanType: toolspb.ScanType_SCAN_TYPE_PING, Ports: "80"},
+		},
+		{
+			name:    "ping scan with service detection",
+			request: &toolspb.NmapRequest{ScanType: toolspb.ScanType_SCAN_TYPE_PING, ServiceDetection: true},
+		},
+		{
+			name:    "script path",
+			request: &toolspb.NmapRequest{Scripts: []string{"/tmp/evil.nse"}},
+		},
+		{
+			name:    "script list smuggled into one entry",
+			request: &toolspb.NmapRequest{Scripts: []string{"default,../evil"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildScanArgs(tt.request); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestHasScanOptions(t *testing.T) {
+	if hasScanOptions(&toolspb.NmapRequest{Args: []string{"-sn"}}) {
+		t.Error("expected raw args alone not to count as structured options")
+	}
+	if !hasScanOptions(&toolspb.NmapRequest{ScanType: toolspb.ScanType_SCAN_TYPE_PING}) {
+		t.Error("expected scan type to count as a structured option")
+	}
+	if !hasScanOptions(&toolspb.NmapRequest{Scripts: []string{"default"}}) {
+		t.Error("expected scripts to count as a structured option")
+	}
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/zero-day-ai/sdk/toolerr"
+)
+
+// Environment variables configuring the scan scope. NMAP_SCOPE_FILE names a
+// JSON file in the scopeConfig format; the list variables are comma-separated
+// and add to whatever the file declares.
+const (
+	scopeFileEnv           = "NMAP_SCOPE_FILE"
+	scopeAllowedCIDRsEnv   = "NMAP_SCOPE_ALLOWED_CIDRS"
+	scopeDeniedCIDRsEnv    = "NMAP_SCOPE_DENIED_CIDRS"
+	scopeAllowedDomainsEnv = "NMAP_SCOPE_ALLOWED_DOMAINS"
+)
+
+// alwaysDeniedCIDRs are never scanned, whatever the configured scope: cloud
+// metadata endpoints, multicast and broadcast
+var alwaysDeniedCIDRs = []string{
+	"169.254.169.254/32", // AWS, GCP, Azure, OpenStack metadata
+	"169.254.170.2/32",   // AWS ECS task metadata
+	"100.100.100.200/32", // Alibaba Cloud metadata
+	"fd00:ec2::254/128",  // AWS IPv6 metadata
+	"224.0.0.0/4",        // IPv4 multicast
+	"ff00::/8",           // IPv6 multicast
+	"255.255.255.255/32", // limited broadcast
+}
+
+// ipv4MappedPrefix holds the IPv4-mapped IPv6 addresses. CIDRs inside it are
+// checked in their IPv4 form; wider IPv6 CIDRs covering it are refused.
+var ipv4MappedPrefix = netip.MustParsePrefix("::ffff:0:0/96")
+
+// scopeConfig is the on-disk and environment form of a scope policy
+type scopeConfig struct {
+	AllowedCIDRs   []string `json:"allowed_cidrs"`
+	DeniedCIDRs    []string `json:"denied_cidrs"`
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// scopePolicy decides which scan targets are in scope. With no allowed CIDRs
+// or domains configured everything not denied is in scope; otherwise a target
+// must match an allowed CIDR or domain suffix. Denied ranges always win.
+type scopePolicy struct {
+	allowed        []netip.Prefix
+	denied         []netip.Prefix
+	allowedDomains []string
+
+	// resolve looks up hostname targets; replaced in tests
+	resolve func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// scopeResult is the outcome of applying a scope policy to the request targets
+type scopeResult struct {
+	Targets  []string // targets to scan, possibly narrowed
+	Excludes []string // denied ranges inside the targets, passed to --exclude
+	Warnings []string // dropped or narrowed targets
+
+	// Hostnames maps the addresses scanned in place of hostname targets back
+	// to the names, so nmap scans exactly the addresses that were checked
+	Hostnames map[netip.Addr][]string
+}
+
+// loadScopePolicy builds the scope policy from NMAP_SCOPE_FILE and the
+// NMAP_SCOPE_* list variables
+func loadScopePolicy() (*scopePolicy, error) {
+	var config scopeConfig
+
+	if path := os.Getenv(scopeFileEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scope file: %w", err)
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse scope file %s: %w", path, err)
+		}
+	}
+
+	config.AllowedCIDRs = append(config.AllowedCIDRs, splitList(os.Getenv(scopeAllowedCIDRsEnv))...)
+	config.DeniedCIDRs = append(config.DeniedCIDRs, splitList(os.Getenv(scopeDeniedCIDRsEnv))...)
+	config.AllowedDomains = append(config.AllowedDomains, splitList(os.Getenv(scopeAllowedDomainsEnv))...)
+
+	return newScopePolicy(config)
+}
+
+// newScopePolicy validates a scope configuration and adds the always-denied ranges
+func newScopePolicy(config scopeConfig) (*scopePolicy, error) {
+	policy := &scopePolicy{resolve: resolveHost}
+
+	for _, cidr := range config.AllowedCIDRs {
+		prefix, err := parseScopePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed CIDR %q: %w", cidr, err)
+		}
+		policy.allowed = append(policy.allowed, prefix)
+	}
+
+	for _, cidr := range append(config.DeniedCIDRs, alwaysDeniedCIDRs...) {
+		prefix, err := parseScopePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied CIDR %q: %w", cidr, err)
+		}
+		policy.denied = append(policy.denied, prefix)
+	}
+
+	for _, domain := range config.AllowedDomains {
+		domain = normalizeHostname(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+		if domain == "" {
+			continue
+		}
+		policy.allowedDomains = append(policy.allowedDomains, domain)
+	}
+
+	return policy, nil
+}
+
+// apply checks every target against the policy. In-scope targets are kept,
+// CIDRs are narrowed to their allowed part, denied ranges inside a target are
+// returned for --exclude and out-of-scope targets are dropped with a warning.
+// Hostnames are replaced by the addresses that were checked, picked the way
+// nmap would for the scan's arguments, so a second lookup by nmap cannot
+// return different ones.
+func (p *scopePolicy) apply(ctx context.Context, targets []string, parsed *nmapArgs) scopeResult {
+	var result scopeResult
+	excluded := make(map[netip.Prefix]bool)
+
+	addExcludes := func(r addrRange) {
+		for _, deny := range p.denied {
+			if r.overlaps(deny) && !excluded[deny] {
+				excluded[deny] = true
+				result.Excludes = append(result.Excludes, deny.String())
+			}
+		}
+	}
+
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+
+		if ip, err := netip.ParseAddr(target); err == nil {
+			if reason := p.checkAddr(ip.Unmap().WithZone("")); reason != "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("target %s dropped: %s", target, reason))
+				continue
+			}
+			result.Targets = append(result.Targets, target)
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(target); err == nil {
+			prefix = unmapPrefix(prefix)
+			if prefix.Overlaps(ipv4MappedPrefix) {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("target %s dropped: covers the IPv4-mapped range %s", target, ipv4MappedPrefix))
+				continue
+			}
+			pieces, reason := p.checkPrefix(prefix)
+			if reason != "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("target %s dropped: %s", target, reason))
+				continue
+			}
+			if len(pieces) != 1 || pieces[0] != prefix {
+				narrowed := make([]string, len(pieces))
+				for i, piece := range pieces {
+					narrowed[i] = piece.String()
+				}
+				result.Warnings = append(result.Warnings, fmt.Sprintf("target %s narrowed to in-scope ranges %s", target, strings.Join(narrowed, ", ")))
+			}
+			for _, piece := range pieces {
+				result.Targets = append(result.Targets, piece.String())
+				addExcludes(prefixRange(piece))
+			}
+			continue
+		}
+
+		if octets, ok := parseOctetRange(target); ok {
+			r := octetRangeBounds(octets)
+			if reason := p.checkRange(r); reason != "" {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("target %s dropped: %s", target, reason))
+				continue
+			}
+			result.Targets = append(result.Targets, target)
+			addExcludes(r)
+			continue
+		}
+
+		addrs, reason := p.checkHostname(ctx, target)
+		if reason == "" {
+			if addrs = scanAddrs(addrs, parsed); len(addrs) == 0 {
+				reason = "has no address of the scan's IP version"
+			}
+		}
+		if reason != "" {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("target %s dropped: %s", target, reason))
+			continue
+		}
+		if result.Hostnames == nil {
+			result.Hostnames = make(map[netip.Addr][]string)
+		}
+		for _, addr := range addrs {
+			result.Targets = append(result.Targets, addr.String())
+			result.Hostnames[addr] = append(result.Hostnames[addr], target)
+		}
+	}
+
+	for _, exclude := range result.Excludes {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("out-of-scope range %s excluded from the scan", exclude))
+	}
+	return result
+}
+
+// enforceScope applies the tool's scope policy before nmap runs. It returns
+// the in-scope result and the scan arguments with denied ranges merged into
+// --exclude, or an error if the policy cannot be loaded, the arguments pick
+// targets the policy cannot check, or no target is left in scope.
+func (t *ToolImpl) enforceScope(ctx context.Context, targets []string, args []string, parsed *nmapArgs) (scopeResult, []string, error) {
+	policy, err := t.scope, t.scopeErr
+	if policy == nil && err == nil {
+		policy, err = loadScopePolicy()
+	}
+	if err != nil {
+		return scopeResult{}, nil, toolerr.New(ToolName, "scope", toolerr.ErrCodeExecutionFailed, fmt.Sprintf("invalid scope configuration: %v", err)).
+			WithCause(err).
+			WithClass(toolerr.ErrorClassInfrastructure)
+	}
+
+	// Options that send traffic to hosts other than the targets are checked
+	// or refused here; the parsed options cover every spelling nmap accepts
+	if err := policy.checkOptions(ctx, parsed); err != nil {
+		return scopeResult{}, nil, toolerr.New(ToolName, "scope", toolerr.ErrCodeInvalidInput, err.Error()).
+			WithCause(err).
+			WithClass(toolerr.ErrorClassSemantic)
+	}
+
+	result := policy.apply(ctx, targets, parsed)
+	if len(result.Targets) == 0 {
+		err := fmt.Errorf("no targets are in scope: %s", strings.Join(result.Warnings, "; "))
+		return result, nil, toolerr.New(ToolName, "scope", toolerr.ErrCodeInvalidInput, err.Error()).
+			WithCause(err).
+			WithClass(toolerr.ErrorClassSemantic)
+	}
+
+	return result, withExcludes(args, result.Excludes), nil
+}
+
+// checkOptions returns an error if the arguments make nmap contact hosts the
+// policy cannot check: random targets (-iR) and targets NSE scripts add
+// (newtargets). The idle scan zombie (-sI) and FTP bounce relay (-b) must be
+// addresses within scope.
+func (p *scopePolicy) checkOptions(ctx context.Context, parsed *nmapArgs) error {
+	for _, option := range parsed.Options {
+		if option.Name == "-iR" {
+			return fmt.Errorf("argument %q is not allowed: random targets cannot be checked against the scan scope", option.Raw)
+		}
+
+		role, ok := relayOptions[option.Name]
+		if !ok {
+			continue
+		}
+		host := relayHost(option.Name, option.Value)
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return fmt.Errorf("%s %q must be an IP address so it can be checked against the scan scope", role, host)
+		}
+		if result := p.apply(ctx, []string{ip.String()}, parsed); len(result.Targets) == 0 {
+			return fmt.Errorf("%s %s is not in scope: %s", role, host, strings.Join(result.Warnings, "; "))
+		}
+	}
+
+	for _, value := range parsed.values("--script-args") {
+		if strings.Contains(strings.ToLower(value), "newtargets") {
+			return fmt.Errorf("script argument newtargets is not allowed: targets added by scripts cannot be checked against the scan scope")
+		}
+	}
+	return nil
+}
+
+// relayOptions are options naming a host nmap sends traffic through, besides
+// the targets
+var relayOptions = map[string]string{
+	"-sI": "idle scan zombie",
+	"-b":  "FTP bounce relay",
+}
+
+// relayHost extracts the host from a -sI value (zombie[:probeport]) or a -b
+// value ([user[:pass]@]server[:port])
+func relayHost(name, value string) string {
+	if name == "-b" {
+		value = value[strings.LastIndex(value, "@")+1:]
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return host
+	}
+	return strings.Trim(value, "[]")
+}
+
+// hasAllowlist reports whether the policy restricts scanning to allowed targets
+func (p *scopePolicy) hasAllowlist() bool {
+	return len(p.allowed) > 0 || len(p.allowedDomains) > 0
+}
+
+// checkAddr returns why an address is out of scope, or "" if it is in scope
+func (p *scopePolicy) checkAddr(ip netip.Addr) string {
+	return p.checkRange(addrRange{lo: ip, hi: ip})
+}
+
+// checkRange returns why an address range is out of scope, or "" if it is in
+// scope. Ranges partially covered by denied CIDRs are in scope; the denied
+// part is excluded separately.
+func (p *scopePolicy) checkRange(r addrRange) string {
+	if deny, ok := p.deniedBy(r); ok {
+		return fmt.Sprintf("within denied range %s", deny)
+	}
+	if !p.allows(r) {
+		return "not within an allowed range"
+	}
+	return ""
+}
+
+// deniedBy returns the denied CIDR that covers the whole range, if any
+func (p *scopePolicy) deniedBy(r addrRange) (netip.Prefix, bool) {
+	for _, deny := range p.denied {
+		if r.within(deny) {
+			return deny, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// allows reports whether the range lies inside an allowed CIDR, or whether
+// there is no allowlist at all
+func (p *scopePolicy) allows(r addrRange) bool {
+	if !p.hasAllowlist() {
+		return true
+	}
+	for _, allow := range p.allowed {
+		if r.within(allow) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrefix returns the in-scope parts of a CIDR target, or why none of it
+// is in scope. Two CIDRs either nest or are disjoint, so each allowed range
+// contributes either the whole target or itself.
+func (p *scopePolicy) checkPrefix(prefix netip.Prefix) ([]netip.Prefix, string) {
+	r := prefixRange(prefix)
+	if deny, ok := p.deniedBy(r); ok {
+		return nil, fmt.Sprintf("within denied range %s", deny)
+	}
+	if p.allows(r) {
+		return []netip.Prefix{prefix}, ""
+	}
+
+	var pieces []netip.Prefix
+	for _, allow := range p.allowed {
+		if prefix.Bits() <= allow.Bits() && prefix.Contains(allow.Addr()) {
+			if _, denied := p.deniedBy(prefixRange(allow)); !denied {
+				pieces = append(pieces, allow)
+			}
+		}
+	}
+	if len(pieces) == 0 {
+		return nil, "not within an allowed range"
+	}
+	return pieces, ""
+}
+
+// checkHostname resolves a hostname target and returns its addresses, or why
+// it is out of scope. Every address it resolves to must be outside the denied
+// ranges and, unless the name matches an allowed domain suffix, inside an
+// allowed range.
+func (p *scopePolicy) checkHostname(ctx context.Context, host string) ([]netip.Addr, string) {
+	resolved, err := p.resolve(ctx, host)
+	if err != nil {
+		return nil, fmt.Sprintf("could not be resolved: %v", err)
+	}
+	if len(resolved) == 0 {
+		return nil, "could not be resolved"
+	}
+
+	allowedName := p.domainAllowed(host)
+	addrs := make([]netip.Addr, 0, len(resolved))
+	for _, addr := range resolved {
+		addr = addr.Unmap().WithZone("")
+		r := addrRange{lo: addr, hi: addr}
+		if deny, ok := p.deniedBy(r); ok {
+			return nil, fmt.Sprintf("resolves to %s within denied range %s", addr, deny)
+		}
+		if !allowedName && !p.allows(r) {
+			return nil, fmt.Sprintf("resolves to %s, not within an allowed range", addr)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, ""
+}
+
+// scanAddrs picks the resolved addresses nmap would scan for a hostname: the
+// first of the scan's IP version, or all of them with --resolve-all
+func scanAddrs(addrs []netip.Addr, parsed *nmapArgs) []netip.Addr {
+	ipv6 := parsed.has("-6")
+	var picked []netip.Addr
+	for _, addr := range addrs {
+		if addr.Is6() != ipv6 || slices.Contains(picked, addr) {
+			continue
+		}
+		picked = append(picked, addr)
+		if !parsed.has("--resolve-all") {
+			break
+		}
+	}
+	return picked
+}
+
+// addHostnames records the hostname targets a host was scanned for, as nmap
+// does for targets given by name, so results can be attributed to them
+func (r scopeResult) addHostnames(host *NmapHost) {
+	for _, address := range host.Addresses {
+		ip, err := netip.ParseAddr(address.Addr)
+		if err != nil {
+			continue
+		}
+		for _, name := range r.Hostnames[ip.Unmap()] {
+			if !slices.ContainsFunc(host.Hostnames, func(h NmapHostname) bool { return strings.EqualFold(h.Name, name) }) {
+				host.Hostnames = append(host.Hostnames, NmapHostname{Name: name, Type: "user"})
+			}
+		}
+	}
+}
+
+// domainAllowed reports whether a hostname matches an allowed domain suffix
+func (p *scopePolicy) domainAllowed(host string) bool {
+	host = normalizeHostname(host)
+	for _, domain := range p.allowedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrRange is an inclusive range of addresses of one family
+type addrRange struct {
+	lo, hi netip.Addr
+}
+
+// within reports whether the whole range lies inside prefix
+func (r addrRange) within(prefix netip.Prefix) bool {
+	return prefix.Contains(r.lo) && prefix.Contains(r.hi)
+}
+
+// overlaps reports whether any part of the range lies inside prefix
+func (r addrRange) overlaps(prefix netip.Prefix) bool {
+	p := prefixRange(prefix)
+	return p.lo.BitLen() == r.lo.BitLen() && p.lo.Compare(r.hi) <= 0 && p.hi.Compare(r.lo) >= 0
+}
+
+// prefixRange returns the first and last address of a CIDR
+func prefixRange(prefix netip.Prefix) addrRange {
+	prefix = prefix.Masked()
+	lo := prefix.Addr()
+
+	b := lo.AsSlice()
+	for bit := prefix.Bits(); bit < len(b)*8; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	hi, _ := netip.AddrFromSlice(b)
+
+	return addrRange{lo: lo, hi: hi}
+}
+
+// octetRangeBounds returns the lowest and highest address of an IPv4 octet range
+func octetRangeBounds(octets [4]octetSet) addrRange {
+	var lo, hi [4]byte
+	for i := range octets {
+		first := true
+		for v, ok := range octets[i] {
+			if !ok {
+				continue
+			}
+			if first {
+				lo[i] = byte(v)
+				first = false
+			}
+			hi[i] = byte(v)
+		}
+	}
+	return addrRange{lo: netip.AddrFrom4(lo), hi: netip.AddrFrom4(hi)}
+}
+
+// parseScopePrefix parses a CIDR or a bare address (treated as a single-host CIDR)
+func parseScopePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if ip, err := netip.ParseAddr(s); err == nil {
+		ip = ip.Unmap()
+		return netip.PrefixFrom(ip, ip.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return unmapPrefix(prefix), nil
+}
+
+// unmapPrefix masks a CIDR and converts an IPv4-mapped IPv6 CIDR such as
+// ::ffff:10.0.0.0/104 to its IPv4 form, so it is checked against IPv4 ranges
+func unmapPrefix(prefix netip.Prefix) netip.Prefix {
+	prefix = prefix.Masked()
+	if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+		return netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+	return prefix
+}
+
+// resolveHost resolves a hostname with the system resolver
+func resolveHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// normalizeHostname lowercases a hostname and strips any trailing dot
+func normalizeHostname(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// withExcludes merges excludes into the scan arguments. nmap honors only the
+// last --exclude, so any the caller passed are folded into a single option.
+func withExcludes(args []string, excludes []string) []string {
+	if len(excludes) == 0 {
+		return args
+	}
+
+	var merged []string
+	var specs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--exclude" || arg == "-exclude":
+			if i+1 < len(args) {
+				i++
+				specs = append(specs, args[i])
+			}
+		case strings.HasPrefix(arg, "--exclude=") || strings.HasPrefix(arg, "-exclude="):
+			specs = append(specs, arg[strings.Index(arg, "=")+1:])
+		default:
+			merged = append(merged, arg)
+		}
+	}
+
+	specs = append(specs, excludes...)
+	return append(merged, "--exclude", strings.Join(specs, ","))
+}
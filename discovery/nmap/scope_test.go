@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+// fakeResolver resolves hostnames from a fixed table
+func fakeResolver(table map[string][]string) func(ctx context.Context, host string) ([]netip.Addr, error) {
+	return func(ctx context.Context, host string) ([]netip.Addr, error) {
+		ips, ok := table[host]
+		if !ok {
+			return nil, fmt.Errorf("no such host")
+		}
+		var addrs []netip.Addr
+		for _, ip := range ips {
+			addrs = append(addrs, netip.MustParseAddr(ip))
+		}
+		return addrs, nil
+	}
+}
+
+func TestScopePolicyApply(t *testing.T) {
+	resolver := fakeResolver(map[string][]string{
+		"app.example.com":   {"203.0.113.10"},
+		"internal.corp":     {"10.1.2.3"},
+		"metadata.internal": {"169.254.169.254"},
+		"elsewhere.net":     {"198.51.100.7"},
+	})
+
+	tests := []struct {
+		name         string
+		config       scopeConfig
+		targets      []string
+		wantTargets  []string
+		wantExcludes []string
+		wantWarnings int
+	}{
+		{
+			name:        "no allowlist keeps ordinary targets",
+			targets:     []string{"192.168.1.1", "10.0.0.0/24", "elsewhere.net"},
+			wantTargets: []string{"192.168.1.1", "10.0.0.0/24", "198.51.100.7"},
+		},
+		{
+			name:         "metadata address always denied",
+			targets:      []string{"169.254.169.254", "192.168.1.1"},
+			wantTargets:  []string{"192.168.1.1"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "multicast and broadcast always denied",
+			targets:      []string{"239.1.2.3", "255.255.255.255", "ff02::1"},
+			wantWarnings: 3,
+		},
+		{
+			name:         "IPv4-mapped metadata address denied",
+			targets:      []string{"::ffff:169.254.169.254", "::ffff:169.254.169.254/128", "::ffff:169.254.0.0/112"},
+			wantTargets:  []string{"169.254.0.0/16"},
+			wantExcludes: []string{"169.254.169.254/32", "169.254.170.2/32"},
+			wantWarnings: 4,
+		},
+		{
+			name:         "IPv6 range covering IPv4-mapped addresses dropped",
+			targets:      []string{"::/64", "2001:db8::/64"},
+			wantTargets:  []string{"2001:db8::/64"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "hostname resolving to metadata denied",
+			targets:      []string{"metadata.internal"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "link-local range excludes metadata",
+			targets:      []string{"169.254.0.0/16"},
+			wantTargets:  []string{"169.254.0.0/16"},
+			wantExcludes: []string{"169.254.169.254/32", "169.254.170.2/32"},
+			wantWarnings: 2,
+		},
+		{
+			name:         "configured deny list",
+			config:       scopeConfig{DeniedCIDRs: []string{"10.0.0.0/8"}},
+			targets:      []string{"10.5.0.0/16", "192.168.1.1"},
+			wantTargets:  []string{"192.168.1.1"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "allowlist drops addresses outside it",
+			config:       scopeConfig{AllowedCIDRs: []string{"192.168.1.0/24"}},
+			targets:      []string{"192.168.1.5", "192.168.2.5"},
+			wantTargets:  []string{"192.168.1.5"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "allowlist narrows wider CIDR",
+			config:       scopeConfig{AllowedCIDRs: []string{"10.0.1.0/24", "10.0.3.0/24"}},
+			targets:      []string{"10.0.0.0/16"},
+			wantTargets:  []string{"10.0.1.0/24", "10.0.3.0/24"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "denied range inside allowed target is excluded",
+			config:       scopeConfig{AllowedCIDRs: []string{"10.0.0.0/16"}, DeniedCIDRs: []string{"10.0.5.0/24"}},
+			targets:      []string{"10.0.0.0/16"},
+			wantTargets:  []string{"10.0.0.0/16"},
+			wantExcludes: []string{"10.0.5.0/24"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "octet range within allowlist",
+			config:       scopeConfig{AllowedCIDRs: []string{"192.168.1.0/24"}},
+			targets:      []string{"192.168.1.1-50", "192.168.1-2.1"},
+			wantTargets:  []string{"192.168.1.1-50"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "allowed domain suffix",
+			config:       scopeConfig{AllowedDomains: []string{"*.example.com"}},
+			targets:      []string{"app.example.com", "elsewhere.net", "203.0.113.10"},
+			wantTargets:  []string{"203.0.113.10"},
+			wantWarnings: 2,
+		},
+		{
+			name:        "hostname resolving into allowed CIDR",
+			config:      scopeConfig{AllowedCIDRs: []string{"10.0.0.0/8"}},
+			targets:     []string{"internal.corp"},
+			wantTargets: []string{"10.1.2.3"},
+		},
+		{
+			name:         "unresolvable hostname dropped",
+			targets:      []string{"missing.example"},
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := newScopePolicy(tt.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			policy.resolve = resolver
+
+			result := policy.apply(context.Background(), tt.targets, &nmapArgs{})
+			if !reflect.DeepEqual(result.Targets, tt.wantTargets) {
+				t.Errorf("expected targets %v, got %v", tt.wantTargets, result.Targets)
+			}
+			if !reflect.DeepEqual(result.Excludes, tt.wantExcludes) {
+				t.Errorf("expected excludes %v, got %v", tt.wantExcludes, result.Excludes)
+			}
+			if len(result.Warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got %v", tt.wantWarnings, result.Warnings)
+			}
+		})
+	}
+}
+
+func TestScopePolicyResolvesHostnames(t *testing.T) {
+	policy, err := newScopePolicy(scopeConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policy.resolve = fakeResolver(map[string][]string{
+		"dual.example": {"2001:db8::1", "203.0.113.5", "203.0.113.6"},
+		"v6.example":   {"2001:db8::2"},
+	})
+
+	tests := []struct {
+		name         string
+		args         []string
+		targets      []string
+		wantTargets  []string
+		wantWarnings int
+	}{
+		{name: "first IPv4 address", targets: []string{"dual.example"}, wantTargets: []string{"203.0.113.5"}},
+		{name: "IPv6 scan", args: []string{"-6"}, targets: []string{"dual.example"}, wantTargets: []string{"2001:db8::1"}},
+		{name: "resolve all", args: []string{"--resolve-all"}, targets: []string{"dual.example"}, wantTargets: []string{"203.0.113.5", "203.0.113.6"}},
+		{name: "no address of the scan's version", targets: []string{"v6.example"}, wantWarnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			result := policy.apply(context.Background(), tt.targets, parsed)
+			if !reflect.DeepEqual(result.Targets, tt.wantTargets) {
+				t.Errorf("expected targets %v, got %v", tt.wantTargets, result.Targets)
+			}
+			if len(result.Warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got %v", tt.wantWarnings, result.Warnings)
+			}
+			for _, target := range result.Targets {
+				if names := result.Hostnames[netip.MustParseAddr(target)]; !reflect.DeepEqual(names, tt.targets) {
+					t.Errorf("expected %s to map back to %v, got %v", target, tt.targets, names)
+				}
+			}
+		})
+	}
+}
+
+func TestScopeResultAddHostnames(t *testing.T) {
+	result := scopeResult{Hostnames: map[netip.Addr][]string{
+		netip.MustParseAddr("203.0.113.5"): {"app.example.com"},
+	}}
+
+	host := NmapHost{
+		Addresses: []NmapAddress{{Addr: "203.0.113.5", AddrType: "ipv4"}},
+		Hostnames: []NmapHostname{{Name: "web1.hosting.net", Type: "PTR"}},
+	}
+	result.addHostnames(&host)
+	result.addHostnames(&host)
+
+	expected := []NmapHostname{{Name: "web1.hosting.net", Type: "PTR"}, {Name: "app.example.com", Type: "user"}}
+	if !reflect.DeepEqual(host.Hostnames, expected) {
+		t.Errorf("expected hostnames %v, got %v", expected, host.Hostnames)
+	}
+	if matched := matchTargets(host, []string{"app.example.com"}); len(matched) != 1 {
+		t.Errorf("expected the host to be attributed to its hostname target, got %v", matched)
+	}
+}
+
+func TestNewScopePolicyInvalid(t *testing.T) {
+	if _, err := newScopePolicy(scopeConfig{AllowedCIDRs: []string{"not-a-cidr"}}); err == nil {
+		t.Error("expected error for invalid allowed CIDR")
+	}
+	if _, err := newScopePolicy(scopeConfig{DeniedCIDRs: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("expected error for invalid denied CIDR")
+	}
+}
+
+func TestLoadScopePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scope.json")
+	config := `{"allowed_cidrs": ["10.0.0.0/8"], "denied_cidrs": ["10.9.0.0/16"], "allowed_domains": ["example.com"]}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(scopeFileEnv, path)
+	t.Setenv(scopeAllowedCIDRsEnv, "192.168.0.0/16, 172.16.0.0/12")
+	t.Setenv(scopeDeniedCIDRsEnv, "")
+	t.Setenv(scopeAllowedDomainsEnv, "corp.local")
+
+	policy, err := loadScopePolicy()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policy.allowed) != 3 {
+		t.Errorf("expected 3 allowed CIDRs from file and environment, got %v", policy.allowed)
+	}
+	if len(policy.denied) != 1+len(alwaysDeniedCIDRs) {
+		t.Errorf("expected configured and always-denied CIDRs, got %v", policy.denied)
+	}
+	if !reflect.DeepEqual(policy.allowedDomains, []string{"example.com", "corp.local"}) {
+		t.Errorf("unexpected allowed domains: %v", policy.allowedDomains)
+	}
+
+	t.Setenv(scopeFileEnv, filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := loadScopePolicy(); err == nil {
+		t.Error("expected error for missing scope file")
+	}
+}
+
+func TestWithExcludes(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		excludes []string
+		expected []string
+	}{
+		{
+			name:     "no excludes",
+			args:     []string{"-sT"},
+			expected: []string{"-sT"},
+		},
+		{
+			name:     "added",
+			args:     []string{"-sT"},
+			excludes: []string{"169.254.169.254/32"},
+			expected: []string{"-sT", "--exclude", "169.254.169.254/32"},
+		},
+		{
+			name:     "merged with caller's exclude",
+			args:     []string{"--exclude", "10.0.0.1", "-sT", "--exclude=10.0.0.2"},
+			excludes: []string{"169.254.169.254/32"},
+			expected: []string{"-sT", "--exclude", "10.0.0.1,10.0.0.2,169.254.169.254/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withExcludes(tt.args, tt.excludes)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteProtoScope(t *testing.T) {
+	policy, err := newScopePolicy(scopeConfig{AllowedCIDRs: []string{"192.168.1.0/24"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tool := &ToolImpl{scope: policy}
+
+	t.Run("nothing in scope", func(t *testing.T) {
+		_, err := tool.ExecuteProto(context.Background(), &toolspb.NmapRequest{
+			Targets: []string{"10.0.0.1", "169.254.169.254"},
+			Args:    []string{"-sn"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "no targets are in scope") {
+			t.Errorf("expected out-of-scope error, got %v", err)
+		}
+	})
+
+	t.Run("random targets", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"-sn", "-iR", "100"},
+			{"-sn", "--iR=10"},
+			{"-sn", "--iR", "10"},
+			{"-sn", "-iR=10"},
+		} {
+			_, err := tool.ExecuteProto(context.Background(), &toolspb.NmapRequest{
+				Targets: []string{"192.168.1.1"},
+				Args:    args,
+			})
+			if err == nil || !strings.Contains(err.Error(), "random targets") {
+				t.Errorf("expected %v to be refused, got %v", args, err)
+			}
+		}
+	})
+
+	t.Run("hosts outside the targets", func(t *testing.T) {
+		tests := []struct {
+			args    []string
+			wantErr string
+		}{
+			{args: []string{"-sI", "192.168.1.20"}},
+			{args: []string{"-sI", "192.168.1.20:8080"}},
+			{args: []string{"-sI", "169.254.169.254"}, wantErr: "idle scan zombie 169.254.169.254 is not in scope"},
+			{args: []string{"--sI=10.0.0.5:80"}, wantErr: "idle scan zombie 10.0.0.5 is not in scope"},
+			{args: []string{"-sI", "zombie.example.com"}, wantErr: "must be an IP address"},
+			{args: []string{"-b", "anonymous:pw@192.168.1.21:21"}},
+			{args: []string{"-nb", "user@169.254.169.254"}, wantErr: "FTP bounce relay 169.254.169.254 is not in scope"},
+			{args: []string{"-b", "ftp.example.com"}, wantErr: "must be an IP address"},
+			{args: []string{"--script", "targets-sniffer", "--script-args", "newtargets"}, wantErr: "newtargets is not allowed"},
+			{args: []string{"--script", "broadcast-ping", "--script-args=newtargets=true,max-newtargets=5"}, wantErr: "newtargets is not allowed"},
+			{args: []string{"--script-args", "max-newtargets=5"}, wantErr: "newtargets is not allowed"},
+			{args: []string{"--script", "http-title", "--script-args", "http.useragent=x"}},
+		}
+
+		for _, tt := range tests {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error parsing %v: %v", tt.args, err)
+			}
+			_, _, err = tool.enforceScope(context.Background(), []string{"192.168.1.1"}, tt.args, parsed)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected %v to be allowed, got %v", tt.args, err)
+				}
+				continue
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %v to be refused with %q, got %v", tt.args, tt.wantErr, err)
+			}
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		broken := &ToolImpl{scopeErr: fmt.Errorf("bad scope file")}
+		_, err := broken.ExecuteProto(context.Background(), &toolspb.NmapRequest{
+			Targets: []string{"192.168.1.1"},
+			Args:    []string{"-sn"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid scope configuration") {
+			t.Errorf("expected scope configuration error, got %v", err)
+		}
+	})
+}
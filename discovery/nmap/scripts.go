@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/zero-day-ai/sdk/api/gen/graphragpb"
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+// scriptFindingSeverity is the severity assigned to NSE script findings. Scripts
+// report observations rather than confirmed vulnerabilities, so they are
+// informational until a downstream analyzer decides otherwise.
+const scriptFindingSeverity = "info"
+
+// Finding categories for NSE script output. Port and host scripts share a
+// category and are distinguished by their target; pre-scan and post-scan
+// scripts run once per scan and have no target.
+const (
+	scriptFindingCategory     = "nse-script"
+	preScriptFindingCategory  = "nse-prescript"
+	postScriptFindingCategory = "nse-postscript"
+)
+
+// convertScript converts an NSE script result to its proto representation,
+// preserving the structured <elem>/<table> output as a key/value tree
+func convertScript(script NmapScript) *toolspb.NmapScript {
+	return &toolspb.NmapScript{
+		Id:       script.ID,
+		Output:   strings.TrimSpace(script.Output),
+		Elements: convertScriptElements(script.Elements),
+	}
+}
+
+// convertScriptElements converts structured script output to a list of tree
+// nodes, in the order nmap wrote them. Leaf elements carry a value; tables
+// carry nested elements instead.
+func convertScriptElements(elements []NmapScriptElement) []*toolspb.NmapScriptElement {
+	if len(elements) == 0 {
+		return nil
+	}
+
+	nodes := make([]*toolspb.NmapScriptElement, 0, len(elements))
+	for _, element := range elements {
+		switch element.XMLName.Local {
+		case "elem":
+			nodes = append(nodes, &toolspb.NmapScriptElement{
+				Key:   element.Key,
+				Value: strings.TrimSpace(element.Value),
+			})
+		case "table":
+			nodes = append(nodes, &toolspb.NmapScriptElement{
+				Key:      element.Key,
+				Elements: convertScriptElements(element.Elements),
+			})
+		}
+	}
+	return nodes
+}
+
+// scriptFinding creates a Finding node for an NSE script result.
+// targetID is the ID of the node the script ran against (a port ID or host IP),
+// or empty for run-level scripts.
+func scriptFinding(script NmapScript, category, targetID string) *graphragpb.Finding {
+	finding := &graphragpb.Finding{
+		Title:    script.ID,
+		Severity: scriptFindingSeverity,
+		Category: ptrStr(category),
+	}
+	if targetID != "" {
+		finding.TargetId = &targetID
+	}
+	if output := strings.TrimSpace(script.Output); output != "" {
+		finding.Description = &output
+	}
+	return finding
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const scriptScanXML = `<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up"/>
+		<address addr="192.168.1.1" addrtype="ipv4"/>
+		<ports>
+			<port protocol="tcp" portid="22">
+				<state state="open"/>
+				<service name="ssh" product="OpenSSH" version="8.2p1"/>
+				<script id="ssh-hostkey" output="&#xa;  3072 aa:bb:cc (RSA)&#xa;">
+					<table>
+						<elem key="type">ssh-rsa</elem>
+						<elem key="bits">3072</elem>
+						<elem key="fingerprint">aabbcc</elem>
+					</table>
+				</script>
+			</port>
+			<port protocol="tcp" portid="80">
+				<state state="open"/>
+				<service name="http"/>
+				<script id="http-title" output="Welcome">
+					<elem key="title">Welcome</elem>
+				</script>
+				<script id="http-methods" output="Supported Methods: GET HEAD">
+					<table key="Supported Methods">
+						<elem>GET</elem>
+						<elem>HEAD</elem>
+					</table>
+				</script>
+			</port>
+		</ports>
+	</host>
+</nmaprun>`
+
+func TestParseScripts(t *testing.T) {
+	nmapRun, err := parseNmapRun([]byte(scriptScanXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	ports := nmapRun.Hosts[0].Ports
+	if len(ports[0].Scripts) != 1 || len(ports[1].Scripts) != 2 {
+		t.Fatalf("expected 1 and 2 scripts, got %d and %d", len(ports[0].Scripts), len(ports[1].Scripts))
+	}
+
+	hostkey := ports[0].Scripts[0]
+	if len(hostkey.Elements) != 1 || hostkey.Elements[0].XMLName.Local != "table" || len(hostkey.Elements[0].Elements) != 3 {
+		t.Fatalf("expected one table with 3 elems, got %+v", hostkey.Elements)
+	}
+	if bits := hostkey.Elements[0].Elements[1]; bits.Key != "bits" || bits.Value != "3072" {
+		t.Errorf("expected bits=3072, got %+v", bits)
+	}
+}
+
+func TestConvertScript(t *testing.T) {
+	nmapRun, err := parseNmapRun([]byte(scriptScanXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	t.Run("structured tree is preserved", func(t *testing.T) {
+		script := convertScript(nmapRun.Hosts[0].Ports[1].Scripts[1])
+
+		if script.Id != "http-methods" {
+			t.Errorf("expected id=http-methods, got %q", script.Id)
+		}
+		if len(script.Elements) != 1 {
+			t.Fatalf("expected 1 top-level element, got %d", len(script.Elements))
+		}
+
+		table := script.Elements[0]
+		if table.Key != "Supported Methods" {
+			t.Errorf("expected table key 'Supported Methods', got %q", table.Key)
+		}
+		if len(table.Elements) != 2 || table.Elements[0].Value != "GET" || table.Elements[1].Value != "HEAD" {
+			t.Errorf("expected [GET HEAD] children, got %+v", table.Elements)
+		}
+	})
+
+	t.Run("document order is preserved", func(t *testing.T) {
+		run, err := parseNmapRun([]byte(`<nmaprun><host><hostscript>
+			<script id="smb-os-discovery" output="OS: Windows">
+				<elem key="os">Windows</elem>
+				<table key="shares">
+					<elem>C$</elem>
+					<table key="IPC$"><elem key="type">pipe</elem></table>
+					<elem>ADMIN$</elem>
+				</table>
+				<elem key="domain">corp.local</elem>
+			</script>
+		</hostscript></host></nmaprun>`))
+		if err != nil {
+			t.Fatalf("unexpected error parsing XML: %v", err)
+		}
+		script := convertScript(run.Hosts[0].HostScripts[0])
+
+		var keys []string
+		for _, element := range script.Elements {
+			keys = append(keys, element.Key)
+		}
+		if strings.Join(keys, ",") != "os,shares,domain" {
+			t.Fatalf("expected elements in document order, got %v", keys)
+		}
+
+		shares := script.Elements[1].Elements
+		if len(shares) != 3 || shares[0].Value != "C$" || shares[1].Key != "IPC$" || shares[2].Value != "ADMIN$" {
+			t.Errorf("expected nested table in document order, got %+v", shares)
+		}
+		if len(shares[1].Elements) != 1 || shares[1].Elements[0].Value != "pipe" {
+			t.Errorf("expected nested table contents, got %+v", shares[1].Elements)
+		}
+	})
+
+	t.Run("output is trimmed", func(t *testing.T) {
+		script := convertScript(nmapRun.Hosts[0].Ports[0].Scripts[0])
+		if script.Output != "3072 aa:bb:cc (RSA)" {
+			t.Errorf("expected trimmed output, got %q", script.Output)
+		}
+	})
+
+	t.Run("scripts are attached to response ports", func(t *testing.T) {
+		response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+
+		ports := response.Hosts[0].Ports
+		if len(ports[0].Scripts) != 1 || ports[0].Scripts[0].Id != "ssh-hostkey" {
+			t.Errorf("expected ssh-hostkey on port 22, got %+v", ports[0].Scripts)
+		}
+		if len(ports[1].Scripts) != 2 {
+			t.Errorf("expected 2 scripts on port 80, got %d", len(ports[1].Scripts))
+		}
+	})
+}
+
+func TestScriptFindings(t *testing.T) {
+	result, err := parseOutput([]byte(scriptScanXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	if len(result.Findings) != 3 {
+		t.Fatalf("expected 3 findings, got %d", len(result.Findings))
+	}
+
+	finding := result.Findings[1]
+	if finding.Title != "http-title" {
+		t.Errorf("expected title=http-title, got %q", finding.Title)
+	}
+	if finding.TargetId == nil || *finding.TargetId != "192.168.1.1:80:tcp" {
+		t.Errorf("expected targetID=192.168.1.1:80:tcp, got %v", finding.TargetId)
+	}
+	if finding.Description == nil || *finding.Description != "Welcome" {
+		t.Errorf("expected description=Welcome, got %v", finding.Description)
+	}
+	if finding.Severity != scriptFindingSeverity {
+		t.Errorf("expected severity=%s, got %q", scriptFindingSeverity, finding.Severity)
+	}
+}
+
+const hostAndRunScriptXML = `<?xml version="1.0"?>
+<nmaprun>
+	<prescript>
+		<script id="broadcast-dhcp-discover" output="Response 1 of 1">
+			<table key="Response 1 of 1">
+				<elem key="Server Identifier">192.168.1.254</elem>
+			</table>
+		</script>
+	</prescript>
+	<host>
+		<status state="up"/>
+		<address addr="192.168.1.10" addrtype="ipv4"/>
+		<hostscript>
+			<script id="clock-skew" output="mean: 0s">
+				<elem key="mean">0</elem>
+			</script>
+			<script id="smb-os-discovery" output="OS: Windows 10"/>
+		</hostscript>
+	</host>
+	<postscript>
+		<script id="reverse-index" output="80/tcp: 192.168.1.10"/>
+	</postscript>
+</nmaprun>`
+
+func TestHostAndRunScripts(t *testing.T) {
+	nmapRun, err := parseNmapRun([]byte(hostAndRunScriptXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	t.Run("all script levels are parsed", func(t *testing.T) {
+		if len(nmapRun.PreScripts) != 1 || nmapRun.PreScripts[0].ID != "broadcast-dhcp-discover" {
+			t.Errorf("expected broadcast-dhcp-discover prescript, got %+v", nmapRun.PreScripts)
+		}
+		if len(nmapRun.Hosts[0].HostScripts) != 2 {
+			t.Errorf("expected 2 host scripts, got %d", len(nmapRun.Hosts[0].HostScripts))
+		}
+		if len(nmapRun.PostScripts) != 1 || nmapRun.PostScripts[0].ID != "reverse-index" {
+			t.Errorf("expected reverse-index postscript, got %+v", nmapRun.PostScripts)
+		}
+	})
+
+	t.Run("scripts are surfaced in response", func(t *testing.T) {
+		response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+
+		if len(response.PreScripts) != 1 || len(response.PostScripts) != 1 {
+			t.Errorf("expected 1 prescript and 1 postscript, got %d and %d", len(response.PreScripts), len(response.PostScripts))
+		}
+		if len(response.Hosts[0].Scripts) != 2 || response.Hosts[0].Scripts[1].Id != "smb-os-discovery" {
+			t.Errorf("expected host scripts on host, got %+v", response.Hosts[0].Scripts)
+		}
+	})
+
+	t.Run("findings are tied to host or scan", func(t *testing.T) {
+		result := buildDiscoveryResult(nmapRun)
+
+		if len(result.Findings) != 4 {
+			t.Fatalf("expected 4 findings, got %d", len(result.Findings))
+		}
+
+		byTitle := make(map[string]int)
+		for i, finding := range result.Findings {
+			byTitle[finding.Title] = i
+		}
+
+		clockSkew := result.Findings[byTitle["clock-skew"]]
+		if clockSkew.TargetId == nil || *clockSkew.TargetId != "192.168.1.10" {
+			t.Errorf("expected clock-skew targetID=192.168.1.10, got %v", clockSkew.TargetId)
+		}
+
+		prescript := result.Findings[byTitle["broadcast-dhcp-discover"]]
+		if prescript.TargetId != nil {
+			t.Errorf("expected prescript finding without target, got %v", *prescript.TargetId)
+		}
+		if prescript.Category == nil || *prescript.Category != preScriptFindingCategory {
+			t.Errorf("expected category=%s, got %v", preScriptFindingCategory, prescript.Category)
+		}
+
+		postscript := result.Findings[byTitle["reverse-index"]]
+		if postscript.Category == nil || *postscript.Category != postScriptFindingCategory {
+			t.Errorf("expected category=%s, got %v", postScriptFindingCategory, postscript.Category)
+		}
+	})
+}
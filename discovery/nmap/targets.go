@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// matchTargets returns the request targets that produced the given host.
+// A host can match several targets (e.g. both "10.0.0.5" and "10.0.0.0/24").
+//
+// Supported target forms mirror nmap's target specification:
+//   - hostnames, matched against the names nmap recorded for the host
+//   - single IPv4/IPv6 addresses
+//   - CIDR blocks ("10.0.0.0/24")
+//   - IPv4 octet ranges ("192.168.1.1-20", "10.0.*.1", "10.0.0,1.5")
+func matchTargets(host NmapHost, targets []string) []string {
+	var addrs []netip.Addr
+	for _, addr := range host.Addresses {
+		if addr.AddrType != "ipv4" && addr.AddrType != "ipv6" {
+			continue
+		}
+		if ip, err := netip.ParseAddr(addr.Addr); err == nil {
+			addrs = append(addrs, ip.Unmap())
+		}
+	}
+
+	var matched []string
+	for _, target := range targets {
+		if targetMatchesHost(strings.TrimSpace(target), host, addrs) {
+			matched = append(matched, target)
+		}
+	}
+	return matched
+}
+
+// targetMatchesHost reports whether a single target specification covers the host
+func targetMatchesHost(target string, host NmapHost, addrs []netip.Addr) bool {
+	if target == "" {
+		return false
+	}
+
+	if ip, err := netip.ParseAddr(target); err == nil {
+		for _, addr := range addrs {
+			if addr == ip.Unmap() {
+				return true
+			}
+		}
+		return false
+	}
+
+	if prefix, err := netip.ParsePrefix(target); err == nil {
+		for _, addr := range addrs {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if octets, ok := parseOctetRange(target); ok {
+		for _, addr := range addrs {
+			if addr.Is4() && octetRangeContains(octets, addr.As4()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Anything else is treated as a hostname
+	for _, hostname := range host.Hostnames {
+		if strings.EqualFold(strings.TrimSuffix(hostname.Name, "."), strings.TrimSuffix(target, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// octetSet is the set of allowed values for one octet of an IPv4 range target
+type octetSet [256]bool
+
+// parseOctetRange parses an nmap IPv4 octet range such as "192.168.1-3.*".
+// Returns false if the target is not an octet range.
+func parseOctetRange(target string) ([4]octetSet, bool) {
+	var octets [4]octetSet
+
+	parts := strings.Split(target, ".")
+	if len(parts) != 4 {
+		return octets, false
+	}
+
+	for i, part := range parts {
+		if part == "*" {
+			for v := range octets[i] {
+				octets[i][v] = true
+			}
+			continue
+		}
+		for _, item := range strings.Split(part, ",") {
+			lo, hi, isRange := strings.Cut(item, "-")
+			if !isRange {
+				hi = lo
+			}
+			// Open-ended ranges ("-100", "200-") are valid in nmap
+			if lo == "" {
+				lo = "0"
+			}
+			if hi == "" {
+				hi = "255"
+			}
+			start, err := strconv.Atoi(lo)
+			if err != nil {
+				return octets, false
+			}
+			end, err := strconv.Atoi(hi)
+			if err != nil || start < 0 || end > 255 || start > end {
+				return octets, false
+			}
+			for v := start; v <= end; v++ {
+				octets[i][v] = true
+			}
+		}
+	}
+	return octets, true
+}
+
+// octetRangeContains reports whether an IPv4 address falls within an octet range
+func octetRangeContains(octets [4]octetSet, ip [4]byte) bool {
+	for i, b := range ip {
+		if !octets[i][b] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMatchTargets(t *testing.T) {
+	host := NmapHost{
+		Addresses: []NmapAddress{
+			{Addr: "10.0.1.25", AddrType: "ipv4"},
+			{Addr: "2001:db8::25", AddrType: "ipv6"},
+			{Addr: "00:11:22:33:44:55", AddrType: "mac"},
+		},
+		Hostnames: []NmapHostname{
+			{Name: "api.example.internal", Type: "user"},
+			{Name: "ip-10-0-1-25.ec2.internal", Type: "PTR"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{"exact ipv4", []string{"10.0.1.25"}, []string{"10.0.1.25"}},
+		{"exact ipv6", []string{"2001:db8::25"}, []string{"2001:db8::25"}},
+		{"cidr", []string{"10.0.0.0/16", "10.0.2.0/24"}, []string{"10.0.0.0/16"}},
+		{"ipv6 cidr", []string{"2001:db8::/64"}, []string{"2001:db8::/64"}},
+		{"octet range", []string{"10.0.1.20-30", "10.0.1.1-10"}, []string{"10.0.1.20-30"}},
+		{"octet wildcard and list", []string{"10.0.*.25", "10.0.0,1.25", "10.0.2,3.*"}, []string{"10.0.*.25", "10.0.0,1.25"}},
+		{"open-ended range", []string{"10.0.1.-30"}, []string{"10.0.1.-30"}},
+		{"user hostname", []string{"api.example.internal"}, []string{"api.example.internal"}},
+		{"hostname is case-insensitive", []string{"API.Example.Internal."}, []string{"API.Example.Internal."}},
+		{"ptr hostname", []string{"ip-10-0-1-25.ec2.internal"}, []string{"ip-10-0-1-25.ec2.internal"}},
+		{"multiple targets", []string{"api.example.internal", "10.0.0.0/8", "192.168.1.1"}, []string{"api.example.internal", "10.0.0.0/8"}},
+		{"no match", []string{"192.168.1.1", "other.example.internal"}, nil},
+		{"mac is not a target", []string{"00:11:22:33:44:55"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchTargets(host, tt.targets)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOctetRange(t *testing.T) {
+	tests := []struct {
+		target string
+		valid  bool
+	}{
+		{"192.168.1.1-254", true},
+		{"192.168.*.1", true},
+		{"10.0.0,2,4-6.1", true},
+		{"10.0.0.200-", true},
+		{"example.com", false},
+		{"a.b.c.d", false},
+		{"10.0.0.256", false},
+		{"10.0.0.20-10", false},
+		{"10.0.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if _, ok := parseOctetRange(tt.target); ok != tt.valid {
+				t.Errorf("parseOctetRange(%q) valid = %v, want %v", tt.target, ok, tt.valid)
+			}
+		})
+	}
+}
+
+func TestResponseHostnamesAndTargets(t *testing.T) {
+	hostnameXML := []byte(`<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.1.25" addrtype="ipv4"/>
+		<hostnames>
+			<hostname name="api.example.internal" type="user"/>
+			<hostname name="ip-10-0-1-25.ec2.internal" type="PTR"/>
+		</hostnames>
+	</host>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.1.26" addrtype="ipv4"/>
+	</host>
+</nmaprun>`)
+
+	nmapRun, err := parseNmapRun(hostnameXML)
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	targets := []string{"api.example.internal", "10.0.1.26"}
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), targets, 1, time.Now())
+
+	host := response.Hosts[0]
+	if len(host.Hostnames) != 2 {
+		t.Fatalf("expected 2 hostnames, got %d", len(host.Hostnames))
+	}
+	if host.Hostnames[0].Type != "user" || host.Hostnames[1].Type != "PTR" {
+		t.Errorf("expected user and PTR hostname types, got %q and %q", host.Hostnames[0].Type, host.Hostnames[1].Type)
+	}
+	if host.Hostname != "api.example.internal" {
+		t.Errorf("expected hostname=api.example.internal, got %q", host.Hostname)
+	}
+	if !reflect.DeepEqual(host.Targets, []string{"api.example.internal"}) {
+		t.Errorf("expected host attributed to api.example.internal, got %v", host.Targets)
+	}
+	if !reflect.DeepEqual(response.Hosts[1].Targets, []string{"10.0.1.26"}) {
+		t.Errorf("expected host attributed to 10.0.1.26, got %v", response.Hosts[1].Targets)
+	}
+}
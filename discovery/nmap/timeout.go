@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+// Scan timeout bounds, matching runtime.timeout in component.yaml
+const (
+	defaultScanTimeout = 5 * time.Minute
+	minScanTimeout     = 30 * time.Second
+	maxScanTimeout     = 30 * time.Minute
+)
+
+// nmapTimeoutPercent is the share of the scan timeout handed to nmap itself.
+// The rest is left for nmap to write its output before the hard deadline.
+const nmapTimeoutPercent = 90
+
+// maxScanDelayDivisor caps the delay between nmap's probes to a fraction of
+// its time budget. Adaptive delays are capped with --max-scan-delay; fixed
+// delays above the cap are not, and such scans are warned that they are likely
+// to be stopped at the timeout.
+const maxScanDelayDivisor = 20
+
+// timingDelays lists the fixed probe delay each timing template sets
+var timingDelays = map[string]time.Duration{
+	"0": 5 * time.Minute, "paranoid": 5 * time.Minute,
+	"1": 15 * time.Second, "sneaky": 15 * time.Second,
+	"2": 400 * time.Millisecond, "polite": 400 * time.Millisecond,
+}
+
+// nmapDurationRegex matches nmap's time values: a number with an optional
+// ms, s, m or h unit, seconds if none is given
+var nmapDurationRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)(ms|s|m|h)?$`)
+
+// effectiveTimeout returns the scan timeout for a request: the request's own
+// timeout, clamped to the manifest bounds, or the remaining context deadline,
+// whichever is shorter, falling back to the default when neither is set. A
+// caller's deadline is never extended; it fails only if it has already passed.
+// The deadline is shortened by the interrupt grace period, or half of what is
+// left if that is less, so nmap can flush a partial result and the response
+// can be returned before the caller gives up.
+func effectiveTimeout(ctx context.Context, req *toolspb.NmapRequest) (time.Duration, error) {
+	var timeout time.Duration
+	if req.TimeoutSeconds > 0 {
+		timeout = min(max(time.Duration(req.TimeoutSeconds)*time.Second, minScanTimeout), maxScanTimeout)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, fmt.Errorf("the caller's deadline has already passed: %w", context.DeadlineExceeded)
+		}
+		remaining -= min(loadCancelPolicy().Interrupt, remaining/2)
+		if timeout == 0 {
+			timeout = min(remaining, maxScanTimeout)
+		} else {
+			timeout = min(timeout, remaining)
+		}
+	}
+
+	if timeout == 0 {
+		return defaultScanTimeout, nil
+	}
+	return timeout, nil
+}
+
+// timeoutArgs translates the scan timeout into nmap's --host-timeout and
+// --max-scan-delay. --host-timeout applies to each host, so nmap gives up on
+// one that stalls; the scan as a whole is bounded by interrupting nmap when
+// the timeout expires. Options already present in args are left to the caller.
+func timeoutArgs(timeout time.Duration, args *nmapArgs) []string {
+	budget := timeout * nmapTimeoutPercent / 100
+
+	var timeoutArgs []string
+	if !args.has("--host-timeout") {
+		timeoutArgs = append(timeoutArgs, "--host-timeout", formatNmapDuration(budget))
+	}
+	if !args.has("--max-scan-delay") {
+		timeoutArgs = append(timeoutArgs, "--max-scan-delay", formatNmapDuration(budget/maxScanDelayDivisor))
+	}
+	return timeoutArgs
+}
+
+// scanDelayWarning returns a warning if a fixed probe delay, set by
+// --scan-delay or a slow timing template, exceeds the share of the timeout a
+// probe is given, or "" if there is none. --max-scan-delay does not shorten
+// such delays, so the scan is bounded by the timeout alone and is likely to
+// return partial results. --scan-delay overrides the template wherever it
+// appears, as in nmap.
+func scanDelayWarning(timeout time.Duration, args *nmapArgs) string {
+	var template, scanDelay *nmapOption
+	for i, option := range args.Options {
+		switch option.Name {
+		case "-T":
+			template = &args.Options[i]
+		case "--scan-delay":
+			scanDelay = &args.Options[i]
+		}
+	}
+
+	var option *nmapOption
+	var delay time.Duration
+	switch {
+	case scanDelay != nil:
+		// nmap rejects values it cannot parse itself
+		option = scanDelay
+		delay, _ = parseNmapDuration(scanDelay.Value)
+	case template != nil:
+		option, delay = template, timingDelays[strings.ToLower(template.Value)]
+	default:
+		return ""
+	}
+
+	if limit := timeout * nmapTimeoutPercent / 100 / maxScanDelayDivisor; delay > limit {
+		return fmt.Sprintf("%s %s delays every probe by %v, more than the %v a %v scan allows per probe; the scan is likely to stop at its timeout with partial results",
+			option.Name, option.Value, delay, limit, timeout)
+	}
+	return ""
+}
+
+// parseNmapDuration parses a time value the way nmap does
+func parseNmapDuration(value string) (time.Duration, error) {
+	matches := nmapDurationRegex.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid time value %q", value)
+	}
+	n, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time value %q", value)
+	}
+	unit := map[string]time.Duration{"ms": time.Millisecond, "": time.Second, "s": time.Second, "m": time.Minute, "h": time.Hour}[matches[2]]
+	return time.Duration(n * float64(unit)), nil
+}
+
+// formatNmapDuration formats a duration in milliseconds, which nmap's time
+// options accept with an "ms" suffix
+func formatNmapDuration(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+func TestEffectiveTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeoutSeconds int32
+		deadline       time.Duration // 0 means no context deadline
+		expected       time.Duration
+	}{
+		{
+			name:     "default",
+			expected: defaultScanTimeout,
+		},
+		{
+			name:           "request value",
+			timeoutSeconds: 600,
+			expected:       10 * time.Minute,
+		},
+		{
+			name:           "request value below minimum",
+			timeoutSeconds: 5,
+			expected:       minScanTimeout,
+		},
+		{
+			name:           "request value above maximum",
+			timeoutSeconds: 7200,
+			expected:       maxScanTimeout,
+		},
+		{
+			name:     "context deadline shorter than default",
+			deadline: 2 * time.Minute,
+			expected: 2*time.Minute - defaultInterruptGracePeriod,
+		},
+		{
+			name:     "context deadline longer than maximum",
+			deadline: time.Hour,
+			expected: maxScanTimeout,
+		},
+		{
+			name:           "context deadline shorter than request value",
+			timeoutSeconds: 600,
+			deadline:       2 * time.Minute,
+			expected:       2*time.Minute - defaultInterruptGracePeriod,
+		},
+		{
+			name:           "request value shorter than context deadline",
+			timeoutSeconds: 60,
+			deadline:       10 * time.Minute,
+			expected:       time.Minute,
+		},
+		{
+			name:     "context deadline below minimum is honored",
+			deadline: 10 * time.Second,
+			expected: 5 * time.Second,
+		},
+		{
+			name:           "context deadline shorter than clamped request value",
+			timeoutSeconds: 5,
+			deadline:       10 * time.Second,
+			expected:       5 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+
+			got, err := effectiveTimeout(ctx, &toolspb.NmapRequest{TimeoutSeconds: tt.timeoutSeconds})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Allow for the time elapsed since the context deadline was set
+			if got > tt.expected || got < tt.expected-time.Second {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEffectiveTimeoutFlushMargin(t *testing.T) {
+	t.Setenv(cancelGracePeriodEnv, "30s")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	got, err := effectiveTimeout(ctx, &toolspb.NmapRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The configured grace period is left before the caller's deadline
+	if expected := 4*time.Minute + 30*time.Second; got > expected || got < expected-time.Second {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestEffectiveTimeoutExpiredDeadline(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, err := effectiveTimeout(ctx, &toolspb.NmapRequest{TimeoutSeconds: 60})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+}
+
+func TestTimeoutArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "default timeout",
+			timeout:  5 * time.Minute,
+			args:     []string{"-sT"},
+			expected: []string{"--host-timeout", "270000ms", "--max-scan-delay", "13500ms"},
+		},
+		{
+			name:     "minimum timeout",
+			timeout:  30 * time.Second,
+			args:     []string{"-sT"},
+			expected: []string{"--host-timeout", "27000ms", "--max-scan-delay", "1350ms"},
+		},
+		{
+			name:     "caller sets host timeout",
+			timeout:  5 * time.Minute,
+			args:     []string{"-sT", "--host-timeout", "1m"},
+			expected: []string{"--max-scan-delay", "13500ms"},
+		},
+		{
+			name:     "caller sets both in --option=value form",
+			timeout:  5 * time.Minute,
+			args:     []string{"--host-timeout=1m", "--max-scan-delay=500ms"},
+			expected: nil,
+		},
+		{
+			name:     "caller sets host timeout abbreviated",
+			timeout:  5 * time.Minute,
+			args:     []string{"--host-time", "1m"},
+			expected: []string{"--max-scan-delay", "13500ms"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := timeoutArgs(tt.timeout, parsed)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanDelayWarning(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		args        []string
+		wantWarning string
+	}{
+		{name: "no delay", timeout: time.Minute, args: []string{"-sT"}},
+		{name: "fast template", timeout: time.Minute, args: []string{"-T4"}},
+		{name: "polite template", timeout: time.Minute, args: []string{"-T2"}},
+		{name: "paranoid template", timeout: maxScanTimeout, args: []string{"-T0"}, wantWarning: "-T 0 delays every probe by 5m0s"},
+		{name: "paranoid template by name", timeout: maxScanTimeout, args: []string{"-T", "paranoid"}, wantWarning: "-T paranoid"},
+		{name: "sneaky template in short scan", timeout: 5 * time.Minute, args: []string{"-T1"}, wantWarning: "-T 1 delays every probe by 15s"},
+		{name: "sneaky template in long scan", timeout: 10 * time.Minute, args: []string{"-T1"}},
+		{name: "last template wins", timeout: time.Minute, args: []string{"-T0", "-T4"}},
+		{name: "scan delay", timeout: time.Minute, args: []string{"--scan-delay", "10s"}, wantWarning: "--scan-delay 10s delays every probe by 10s, more than the 2.7s"},
+		{name: "scan delay without unit", timeout: time.Minute, args: []string{"--scan-delay=5"}, wantWarning: "delays every probe by 5s"},
+		{name: "short scan delay", timeout: time.Minute, args: []string{"--scan-delay", "500ms"}},
+		{name: "scan delay overrides template", timeout: time.Minute, args: []string{"--scan-delay", "100ms", "-T1"}},
+		{name: "invalid scan delay left to nmap", timeout: time.Minute, args: []string{"--scan-delay", "soon"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseNmapArgs(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			warning := scanDelayWarning(tt.timeout, parsed)
+			if tt.wantWarning == "" {
+				if warning != "" {
+					t.Errorf("unexpected warning: %s", warning)
+				}
+				return
+			}
+			if !strings.Contains(warning, tt.wantWarning) {
+				t.Errorf("expected warning containing %q, got %q", tt.wantWarning, warning)
+			}
+		})
+	}
+}
+
+func TestParseNmapDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"500ms": 500 * time.Millisecond,
+		"10":    10 * time.Second,
+		"1.5s":  1500 * time.Millisecond,
+		"2m":    2 * time.Minute,
+		"1h":    time.Hour,
+	}
+	for value, expected := range tests {
+		got, err := parseNmapDuration(value)
+		if err != nil || got != expected {
+			t.Errorf("parseNmapDuration(%q) = %v, %v; expected %v", value, got, err, expected)
+		}
+	}
+
+	for _, value := range []string{"", "soon", "-1s", "5d"} {
+		if _, err := parseNmapDuration(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
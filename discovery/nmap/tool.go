@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/zero-day-ai/sdk/api/gen/graphragpb"
 	"github.com/zero-day-ai/sdk/api/gen/toolspb"
-	"github.com/zero-day-ai/sdk/exec"
 	"github.com/zero-day-ai/sdk/health"
 	"github.com/zero-day-ai/sdk/tool"
 	"github.com/zero-day-ai/sdk/toolerr"
@@ -18,8 +23,8 @@ import (
 )
 
 const (
-	ToolName    = "nmap"
-	ToolVersion = "1.0.0"
+	ToolName        = "nmap"
+	ToolVersion     = "1.0.0"
 	ToolDescription = `Network mapper and port scanner. Targets and args are passed; tool automatically adds "-oX -" for XML output.
 
 SCAN TYPES:
@@ -49,6 +54,59 @@ DETECTION:
   -O               OS detection
   --osscan-guess   Aggressive OS guessing
 
+STRUCTURED REQUESTS:
+  Instead of raw args, a request can set typed fields; args are still appended as an escape hatch.
+  scan_type          ping, syn, connect, udp, ack, window, maimon
+  timing             paranoid, sneaky, polite, normal, aggressive, insane
+  ports              Port spec, e.g. "22,80,443" or "1-1000" (exclusive with top_ports)
+  top_ports          Scan the N most common ports
+  service_detection  Version detection (-sV)
+  os_detection       OS detection (-O)
+  scripts            NSE scripts or categories, e.g. ["default", "http-title"]
+  auto_downgrade     Rewrite options that need privileges instead of rejecting the request
+
+BLOCKED OPTIONS:
+  Options that read or write local files are rejected in any spelling: -o*, -m, --append-output, -iL,
+  --excludefile, --resume, --datadir, --servicedb, --versiondb, --stylesheet, --script-args-file,
+  scripts given by path and script args naming local files (userdb, passdb, *file, *db,
+  http-fetch.destination, dns-brute.hostlist, tftp-enum.filelist, smb-psexec.config).
+  Targets must be given in targets, not as positional args.
+
+PRIVILEGES:
+  Unless nmap can be elevated (root, passwordless sudo or CAP_NET_RAW on the nmap binary itself) or
+  with --unprivileged, options that need raw sockets are rejected wherever they appear, including
+  combined forms (-sSV), options implied by -A, privileged pings (-PE/-PP/-PU/-PY), SCTP and
+  protocol scans, --send-eth and spoofing options (-S, -D, --spoof-mac, -f).
+  With auto_downgrade, -sS and -sA become -sT, -sU falls back to -sT when no other scan type is left
+  (UDP ports are then not scanned), and options without an alternative such as -O and --traceroute
+  are dropped. Every rewrite is listed in the response warnings.
+  Only scans using such options are elevated. When the worker has root, the nmap binary gets
+  CAP_NET_RAW (file or ambient capabilities) or passwordless sudo is available, nmap runs as-is, with
+  --privileged or via sudo -n respectively; the choice is reported as elevation_strategy.
+
+SCOPE:
+  Targets are checked against the configured engagement scope before scanning. Out-of-scope targets
+  are dropped with a warning, denied ranges inside a target are passed to --exclude, and cloud
+  metadata, multicast and broadcast addresses are never scanned. -iR and the newtargets script argument
+  are not allowed; an idle scan zombie (-sI) or FTP bounce relay (-b) must be an in-scope IP address.
+  Hostnames are resolved once and nmap scans the checked addresses; hosts keep the name as a "user"
+  hostname.
+
+TIMEOUT:
+  Scans are bounded by the request timeout (30s to 30m, default 5m) or the caller's deadline, less
+  the interrupt grace period so partial results arrive in time, whichever is shorter. --host-timeout (per host) and --max-scan-delay are derived from it unless given in args.
+  Fixed probe delays (-T0, -T1, --scan-delay) are not shortened; if they cannot fit in the timeout a
+  warning says the scan is likely to stop there with partial results.
+  On timeout or cancellation nmap gets SIGINT to flush partial results, then SIGTERM and SIGKILL
+  (to its whole process group) if it does not exit; each step is reported as a warning.
+  If nmap fails after finishing some hosts, they are returned with partial_reason "failed".
+
+DIAGNOSTICS:
+  Known nmap stderr messages (unresolvable targets, unusable devices, missing privileges, retransmission
+  caps, fatal errors) are returned as diagnostics with a code and severity, and explain failed runs.
+  Failed runs carry a reason as their error code (BINARY_NOT_FOUND, PERMISSION_DENIED, TIMEOUT,
+  NMAP_ERROR, the upper-cased diagnostic code, ...) alongside the retry class.
+
 COMMON EXAMPLES:
   Quick host discovery: ["-sn"]
   Fast port scan: ["-sT", "-T4", "--top-ports", "100"]
@@ -59,14 +117,18 @@ COMMON EXAMPLES:
 )
 
 // ToolImpl implements the nmap tool
-type ToolImpl struct{}
+type ToolImpl struct {
+	// scope restricts which targets may be scanned; loaded from the environment
+	scope    *scopePolicy
+	scopeErr error
+}
 
 // NewTool creates a new nmap tool instance
 func NewTool() tool.Tool {
-	return &ToolImpl{}
+	scope, err := loadScopePolicy()
+	return &ToolImpl{scope: scope, scopeErr: err}
 }
 
-
 // Name returns the tool name
 func (t *ToolImpl) Name() string {
 	return ToolName
@@ -103,70 +165,13 @@ func (t *ToolImpl) OutputMessageType() string {
 	return "gibson.tools.NmapResponse"
 }
 
-// ExecuteProto runs the nmap tool with proto message input
+// ExecuteProto runs the nmap tool with proto message input. It runs the same
+// engine as StreamExecuteProto, discarding events and returning the final response.
 func (t *ToolImpl) ExecuteProto(ctx context.Context, input proto.Message) (proto.Message, error) {
-	startTime := time.Now()
-
-	// Type assert input to NmapRequest
-	req, ok := input.(*toolspb.NmapRequest)
-	if !ok {
-		return nil, fmt.Errorf("invalid input type: expected *toolspb.NmapRequest, got %T", input)
-	}
-
-	// Validate required fields
-	if len(req.Targets) == 0 {
-		return nil, fmt.Errorf("at least one target is required")
-	}
-
-	if len(req.Args) == 0 {
-		return nil, fmt.Errorf("at least one argument is required")
-	}
-
-	// Validate flags against capabilities
-	caps := tool.GetCapabilities(ctx, t)
-	if caps != nil {
-		if blockedFlag, alternative, blocked := validateFlags(caps, req.Args); blocked {
-			errMsg := fmt.Sprintf("flag '%s' requires elevated privileges and is blocked", blockedFlag)
-			if alternative != "" {
-				errMsg = fmt.Sprintf("%s. Try using '%s' instead", errMsg, alternative)
-			}
-			return nil, toolerr.New(ToolName, "validate", toolerr.ErrCodeInvalidInput, errMsg).
-				WithClass(toolerr.ErrorClassSemantic)
-		}
-	}
-
-	// Build command arguments: -oX - (XML output to stdout) + user args + targets
-	args := []string{"-oX", "-"}
-	args = append(args, req.Args...)
-	args = append(args, req.Targets...)
-
-	// Execute nmap command
-	result, err := exec.Run(ctx, exec.Config{
-		Command: BinaryName,
-		Args:    args,
-		Timeout: 5 * time.Minute, // Default timeout
-	})
-
+	response, err := t.scan(ctx, input, discardSink{})
 	if err != nil {
-		// Classify execution errors based on underlying cause
-		errClass := classifyExecutionError(err)
-		return nil, toolerr.New(ToolName, "execute", toolerr.ErrCodeExecutionFailed, err.Error()).
-			WithCause(err).
-			WithClass(errClass)
+		return nil, err
 	}
-
-	// Parse nmap XML output to proto types
-	discoveryResult, err := parseOutput(result.Stdout)
-	if err != nil {
-		return nil, toolerr.New(ToolName, "parse", toolerr.ErrCodeParseError, err.Error()).
-			WithCause(err).
-			WithClass(toolerr.ErrorClassSemantic)
-	}
-
-	// Convert discovery result to NmapResponse
-	scanDuration := time.Since(startTime).Seconds()
-	response := convertToProtoResponse(discoveryResult, scanDuration, startTime)
-
 	return response, nil
 }
 
@@ -177,31 +182,100 @@ func (t *ToolImpl) Health(ctx context.Context) types.HealthStatus {
 
 // NmapRun represents the root XML element
 type NmapRun struct {
-	XMLName xml.Name   `xml:"nmaprun"`
-	Hosts   []NmapHost `xml:"host"`
+	XMLName          xml.Name       `xml:"nmaprun"`
+	Scanner          string         `xml:"scanner,attr"`
+	Version          string         `xml:"version,attr"`
+	Args             string         `xml:"args,attr"`
+	Start            string         `xml:"start,attr"`
+	XMLOutputVersion string         `xml:"xmloutputversion,attr"`
+	ScanInfo         []NmapScanInfo `xml:"scaninfo"`
+	PreScripts       []NmapScript   `xml:"prescript>script"`
+	Hosts            []NmapHost     `xml:"host"`
+	PostScripts      []NmapScript   `xml:"postscript>script"`
+	RunStats         NmapRunStats   `xml:"runstats"`
+
+	// Truncated is set when the document ended before </nmaprun>, e.g. after
+	// an interrupted scan. Hosts then holds only the fully closed <host> elements.
+	Truncated bool `xml:"-"`
+}
+
+// NmapScanInfo describes one scan type nmap ran (e.g. "syn" over "tcp")
+type NmapScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices string `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+// NmapTaskEvent is one of nmap's <taskbegin>, <taskprogress> or <taskend> events
+// for a scan phase such as "SYN Stealth Scan". Percent, Remaining (seconds) and
+// Etc (estimated completion, unix time) are only set on taskprogress.
+type NmapTaskEvent struct {
+	XMLName   xml.Name
+	Task      string  `xml:"task,attr"`
+	Time      string  `xml:"time,attr"`
+	Percent   float64 `xml:"percent,attr"`
+	Remaining int64   `xml:"remaining,attr"`
+	Etc       int64   `xml:"etc,attr"`
+	ExtraInfo string  `xml:"extrainfo,attr"`
+}
+
+// NmapRunStats represents nmap's own summary of the run
+type NmapRunStats struct {
+	Finished NmapFinished  `xml:"finished"`
+	Hosts    NmapHostStats `xml:"hosts"`
+}
+
+// NmapFinished records when and how the run ended. Exit is "success" or "error".
+type NmapFinished struct {
+	Time     string `xml:"time,attr"`
+	Elapsed  string `xml:"elapsed,attr"`
+	Summary  string `xml:"summary,attr"`
+	Exit     string `xml:"exit,attr"`
+	ErrorMsg string `xml:"errormsg,attr"`
+}
+
+// NmapHostStats holds nmap's host counts, which include hosts not listed in the output
+type NmapHostStats struct {
+	Up    string `xml:"up,attr"`
+	Down  string `xml:"down,attr"`
+	Total string `xml:"total,attr"`
 }
 
 // NmapHost represents a scanned host
 type NmapHost struct {
-	Status    NmapStatus     `xml:"status"`
-	Addresses []NmapAddress  `xml:"address"`
-	Hostnames []NmapHostname `xml:"hostnames>hostname"`
-	Ports     []NmapPort     `xml:"ports>port"`
-	OS        NmapOS         `xml:"os"`
+	Status        NmapStatus       `xml:"status"`
+	Addresses     []NmapAddress    `xml:"address"`
+	Hostnames     []NmapHostname   `xml:"hostnames>hostname"`
+	Ports         []NmapPort       `xml:"ports>port"`
+	ExtraPorts    []NmapExtraPorts `xml:"ports>extraports"`
+	OS            NmapOS           `xml:"os"`
+	HostScripts   []NmapScript     `xml:"hostscript>script"`
+	Trace         *NmapTrace       `xml:"trace"`
+	Times         *NmapTimes       `xml:"times"`
+	Distance      *NmapDistance    `xml:"distance"`
+	Uptime        *NmapUptime      `xml:"uptime"`
+	TCPSequence   *NmapTCPSequence `xml:"tcpsequence"`
+	IPIDSequence  *NmapSequence    `xml:"ipidsequence"`
+	TCPTSSequence *NmapSequence    `xml:"tcptssequence"`
 }
 
 // NmapStatus represents host status
 type NmapStatus struct {
-	State string `xml:"state,attr"`
+	State     string `xml:"state,attr"`
+	Reason    string `xml:"reason,attr"`
+	ReasonTTL string `xml:"reason_ttl,attr"`
 }
 
-// NmapAddress represents an address
+// NmapAddress represents an address. Vendor is only set for MAC addresses.
 type NmapAddress struct {
 	Addr     string `xml:"addr,attr"`
 	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr"`
 }
 
-// NmapHostname represents a hostname
+// NmapHostname represents a hostname. Type is "user" for names given as scan
+// targets and "PTR" for names found by reverse DNS.
 type NmapHostname struct {
 	Name string `xml:"name,attr"`
 	Type string `xml:"type,attr"`
@@ -209,35 +283,123 @@ type NmapHostname struct {
 
 // NmapPort represents a port
 type NmapPort struct {
-	Protocol string        `xml:"protocol,attr"`
-	PortID   int           `xml:"portid,attr"`
-	State    NmapState     `xml:"state"`
-	Service  NmapService   `xml:"service"`
-	Scripts  []NmapScript  `xml:"script"`
+	Protocol string       `xml:"protocol,attr"`
+	PortID   int          `xml:"portid,attr"`
+	State    NmapState    `xml:"state"`
+	Service  NmapService  `xml:"service"`
+	Scripts  []NmapScript `xml:"script"`
 }
 
-// NmapScript represents an NSE script result
+// NmapScript represents an NSE script result. Scripts that produce structured
+// output emit nested <elem> and <table> children alongside the raw output;
+// they are decoded in document order.
 type NmapScript struct {
-	ID     string `xml:"id,attr"`
-	Output string `xml:"output,attr"`
+	ID       string              `xml:"id,attr"`
+	Output   string              `xml:"output,attr"`
+	Elements []NmapScriptElement `xml:",any"`
+}
+
+// NmapScriptElement is one child of structured script output: an <elem> with a
+// key and value, or a (possibly nested) <table> of further elements. The key
+// is omitted for array-style tables.
+type NmapScriptElement struct {
+	XMLName  xml.Name
+	Key      string              `xml:"key,attr"`
+	Value    string              `xml:",chardata"`
+	Elements []NmapScriptElement `xml:",any"`
 }
 
-// NmapState represents port state
+// NmapState represents port state and why nmap concluded it
+// (e.g. "syn-ack", "reset", "no-response", "admin-prohibited")
 type NmapState struct {
-	State string `xml:"state,attr"`
+	State     string `xml:"state,attr"`
+	Reason    string `xml:"reason,attr"`
+	ReasonTTL string `xml:"reason_ttl,attr"`
+	ReasonIP  string `xml:"reason_ip,attr"`
+}
+
+// NmapExtraPorts summarises ports nmap did not list individually,
+// e.g. "995 filtered" ports that all had the same state
+type NmapExtraPorts struct {
+	State   string             `xml:"state,attr"`
+	Count   string             `xml:"count,attr"`
+	Reasons []NmapExtraReasons `xml:"extrareasons"`
+}
+
+// NmapExtraReasons breaks down an extraports summary by reason
+type NmapExtraReasons struct {
+	Reason string `xml:"reason,attr"`
+	Count  string `xml:"count,attr"`
+	Proto  string `xml:"proto,attr"`
+	Ports  string `xml:"ports,attr"`
 }
 
 // NmapService represents a service
 type NmapService struct {
-	Name    string   `xml:"name,attr"`
-	Product string   `xml:"product,attr"`
-	Version string   `xml:"version,attr"`
-	CPE     []string `xml:"cpe"`
+	Name       string   `xml:"name,attr"`
+	Product    string   `xml:"product,attr"`
+	Version    string   `xml:"version,attr"`
+	ExtraInfo  string   `xml:"extrainfo,attr"`
+	OSType     string   `xml:"ostype,attr"`
+	Hostname   string   `xml:"hostname,attr"`
+	DeviceType string   `xml:"devicetype,attr"`
+	Tunnel     string   `xml:"tunnel,attr"`
+	Method     string   `xml:"method,attr"` // "probed" for -sV matches, "table" for nmap-services guesses
+	Conf       string   `xml:"conf,attr"`   // detection confidence, 0-10
+	CPE        []string `xml:"cpe"`
+}
+
+// NmapTimes represents nmap's round-trip timing estimates for a host, in microseconds
+type NmapTimes struct {
+	SRTT    string `xml:"srtt,attr"`
+	RTTVar  string `xml:"rttvar,attr"`
+	Timeout string `xml:"to,attr"`
+}
+
+// NmapDistance represents the network distance to a host in hops
+type NmapDistance struct {
+	Value string `xml:"value,attr"`
+}
+
+// NmapUptime represents the uptime guess from TCP timestamps (requires -O)
+type NmapUptime struct {
+	Seconds  string `xml:"seconds,attr"`
+	LastBoot string `xml:"lastboot,attr"`
+}
+
+// NmapTCPSequence represents TCP initial sequence number predictability (requires -O)
+type NmapTCPSequence struct {
+	Index      string `xml:"index,attr"`
+	Difficulty string `xml:"difficulty,attr"`
+	Values     string `xml:"values,attr"`
+}
+
+// NmapSequence represents IP ID or TCP timestamp sequence classification (requires -O)
+type NmapSequence struct {
+	Class  string `xml:"class,attr"`
+	Values string `xml:"values,attr"`
+}
+
+// NmapTrace represents traceroute results (--traceroute or -A)
+type NmapTrace struct {
+	Port     int       `xml:"port,attr"`
+	Protocol string    `xml:"proto,attr"`
+	Hops     []NmapHop `xml:"hop"`
+}
+
+// NmapHop represents a single traceroute hop. Hops that timed out are omitted
+// by nmap, so TTLs may have gaps.
+type NmapHop struct {
+	TTL    int    `xml:"ttl,attr"`
+	IPAddr string `xml:"ipaddr,attr"`
+	RTT    string `xml:"rtt,attr"` // milliseconds
+	Host   string `xml:"host,attr"`
 }
 
 // NmapOS represents OS detection results
 type NmapOS struct {
-	OSMatches []NmapOSMatch `xml:"osmatch"`
+	OSMatches      []NmapOSMatch       `xml:"osmatch"`
+	OSFingerprints []NmapOSFingerprint `xml:"osfingerprint"`
 }
 
 // NmapOSMatch represents an OS match
@@ -249,33 +411,42 @@ type NmapOSMatch struct {
 
 // NmapOSClass represents an OS classification
 type NmapOSClass struct {
-	Family   string `xml:"family,attr"`
-	Vendor   string `xml:"vendor,attr"`
-	OSGen    string `xml:"osgen,attr"`
-	Accuracy string `xml:"accuracy,attr"`
+	Type     string   `xml:"type,attr"`
+	Vendor   string   `xml:"vendor,attr"`
+	Family   string   `xml:"osfamily,attr"`
+	OSGen    string   `xml:"osgen,attr"`
+	Accuracy string   `xml:"accuracy,attr"`
+	CPE      []string `xml:"cpe"`
+}
+
+// NmapOSFingerprint represents the raw TCP/IP fingerprint nmap submits for unknown OSes
+type NmapOSFingerprint struct {
+	Fingerprint string `xml:"fingerprint,attr"`
 }
 
 // parseOutput parses the XML output from nmap and returns proto DiscoveryResult directly
 func parseOutput(data []byte) (*graphragpb.DiscoveryResult, error) {
-	var nmapRun NmapRun
-	if err := xml.Unmarshal(data, &nmapRun); err != nil {
-		return nil, fmt.Errorf("failed to parse nmap XML: %w", err)
+	nmapRun, err := parseNmapRun(data)
+	if err != nil {
+		return nil, err
 	}
+	return buildDiscoveryResult(nmapRun), nil
+}
+
+// parseNmapRun parses the XML output from nmap. Truncated output is tolerated:
+// the completed hosts are returned and the run is flagged as Truncated.
+func parseNmapRun(data []byte) (*NmapRun, error) {
+	return parseNmapStream(bytes.NewReader(data), nil)
+}
 
+// buildDiscoveryResult converts a parsed nmap run into graph nodes for storage
+func buildDiscoveryResult(nmapRun *NmapRun) *graphragpb.DiscoveryResult {
 	result := &graphragpb.DiscoveryResult{}
 
 	for _, host := range nmapRun.Hosts {
-		// Get IP address
-		ip := ""
-		for _, addr := range host.Addresses {
-			if addr.AddrType == "ipv4" || addr.AddrType == "ipv6" {
-				ip = addr.Addr
-				break
-			}
-		}
-
-		// Skip if no IP address found
-		if ip == "" {
+		// Skip if nmap reported no usable address at all
+		hostID := hostIdentity(host)
+		if hostID == "" {
 			continue
 		}
 
@@ -291,10 +462,18 @@ func parseOutput(data []byte) (*graphragpb.DiscoveryResult, error) {
 			os = host.OS.OSMatches[0].Name
 		}
 
-		// Create Host node using proto type
+		// Create Host node using proto type. MAC-only hosts have no IP; they
+		// are identified by their MAC, which their ports and findings refer to.
+		mac, macVendor := hostMAC(host)
 		hostNode := &graphragpb.Host{
-			Ip:    ip,
-			State: ptrStr(host.Status.State),
+			Ip:        hostIP(host),
+			State:     ptrStr(host.Status.State),
+			Mac:       optStr(mac),
+			MacVendor: optStr(macVendor),
+		}
+		applyHostTiming(hostNode, host)
+		for _, addr := range host.Addresses {
+			hostNode.Addresses = append(hostNode.Addresses, addr.Addr)
 		}
 		if hostname != "" {
 			hostNode.Hostname = &hostname
@@ -308,41 +487,205 @@ func parseOutput(data []byte) (*graphragpb.DiscoveryResult, error) {
 		for _, port := range host.Ports {
 			// Create Port node using proto type
 			portNode := &graphragpb.Port{
-				HostId:   ip,
+				HostId:   hostID,
 				Number:   int32(port.PortID),
 				Protocol: port.Protocol,
 				State:    ptrStr(port.State.State),
 			}
 			result.Ports = append(result.Ports, portNode)
 
+			// Construct PortID in format "{host_id}:{number}:{protocol}"
+			portID := fmt.Sprintf("%s:%d:%s", hostID, port.PortID, port.Protocol)
+
 			// Create Service node if service information is available
 			if port.Service.Name != "" {
-				// Construct PortID in format "{host_id}:{number}:{protocol}"
-				portID := fmt.Sprintf("%s:%d:%s", ip, port.PortID, port.Protocol)
-
-				// Build version string
-				version := strings.TrimSpace(port.Service.Product)
-				if port.Service.Version != "" {
-					if version != "" {
-						version = fmt.Sprintf("%s %s", version, port.Service.Version)
-					} else {
-						version = port.Service.Version
-					}
-				}
-
-				serviceNode := &graphragpb.Service{
-					PortId: portID,
-					Name:   port.Service.Name,
-				}
-				if version != "" {
-					serviceNode.Version = &version
-				}
-				result.Services = append(result.Services, serviceNode)
+				result.Services = append(result.Services, buildServiceNode(port.Service, portID))
+			}
+
+			// Emit NSE script results as findings attached to the port
+			for _, script := range port.Scripts {
+				result.Findings = append(result.Findings, scriptFinding(script, scriptFindingCategory, portID))
+			}
+		}
+
+		// Emit host-level script results as findings attached to the host
+		for _, script := range host.HostScripts {
+			result.Findings = append(result.Findings, scriptFinding(script, scriptFindingCategory, hostID))
+		}
+	}
+
+	// Build network topology from traceroute hops once all scanned hosts are known
+	topology := newTraceGraph(result.Hosts)
+	for _, host := range nmapRun.Hosts {
+		if host.Trace == nil {
+			continue
+		}
+		if hostID := hostIdentity(host); hostID != "" {
+			topology.add(result, host.Trace, hostID)
+		}
+	}
+
+	// Pre-scan and post-scan scripts are not tied to any host; they describe the scan as a whole
+	for _, script := range nmapRun.PreScripts {
+		result.Findings = append(result.Findings, scriptFinding(script, preScriptFindingCategory, ""))
+	}
+	for _, script := range nmapRun.PostScripts {
+		result.Findings = append(result.Findings, scriptFinding(script, postScriptFindingCategory, ""))
+	}
+
+	return result
+}
+
+// hostIP returns the primary IP address reported for the host. IPv4 is preferred
+// over IPv6 regardless of the order nmap lists them in, so dual-stack hosts get
+// the same primary address on every scan.
+func hostIP(host NmapHost) string {
+	ipv6 := ""
+	for _, addr := range host.Addresses {
+		switch addr.AddrType {
+		case "ipv4":
+			return addr.Addr
+		case "ipv6":
+			if ipv6 == "" {
+				ipv6 = addr.Addr
 			}
 		}
 	}
+	return ipv6
+}
 
-	return result, nil
+// hostMAC returns the MAC address and OUI vendor reported for the host, if any
+func hostMAC(host NmapHost) (mac string, vendor string) {
+	for _, addr := range host.Addresses {
+		if addr.AddrType == "mac" {
+			return addr.Addr, addr.Vendor
+		}
+	}
+	return "", ""
+}
+
+// hostIdentity returns a stable identifier for the host: its primary IP, or its
+// MAC address for hosts nmap reports without any IP address
+func hostIdentity(host NmapHost) string {
+	if ip := hostIP(host); ip != "" {
+		return ip
+	}
+	mac, _ := hostMAC(host)
+	return mac
+}
+
+// serviceVersion builds a "product version" string from service detection output
+func serviceVersion(service NmapService) string {
+	version := strings.TrimSpace(service.Product)
+	if service.Version != "" {
+		if version != "" {
+			version = fmt.Sprintf("%s %s", version, service.Version)
+		} else {
+			version = service.Version
+		}
+	}
+	return version
+}
+
+// buildServiceNode creates a Service graph node with full service detection detail
+func buildServiceNode(service NmapService, portID string) *graphragpb.Service {
+	serviceNode := &graphragpb.Service{
+		PortId:     portID,
+		Name:       service.Name,
+		Version:    optStr(serviceVersion(service)),
+		Product:    optStr(service.Product),
+		ExtraInfo:  optStr(service.ExtraInfo),
+		OsType:     optStr(service.OSType),
+		Hostname:   optStr(service.Hostname),
+		DeviceType: optStr(service.DeviceType),
+		Tunnel:     optStr(service.Tunnel),
+		Method:     optStr(service.Method),
+		Cpes:       service.CPE,
+	}
+	if service.Conf != "" {
+		conf := parseInt32(service.Conf)
+		serviceNode.Confidence = &conf
+	}
+	return serviceNode
+}
+
+// convertService converts nmap service detection output to proto
+func convertService(service NmapService) *toolspb.NmapService {
+	return &toolspb.NmapService{
+		Name:       service.Name,
+		Version:    serviceVersion(service),
+		Product:    service.Product,
+		ExtraInfo:  service.ExtraInfo,
+		OsType:     service.OSType,
+		Hostname:   service.Hostname,
+		DeviceType: service.DeviceType,
+		Tunnel:     service.Tunnel,
+		Method:     service.Method,
+		Confidence: parseInt32(service.Conf),
+		Cpes:       service.CPE,
+	}
+}
+
+// convertExtraPorts converts the summary of ports nmap did not list individually
+func convertExtraPorts(extraPorts []NmapExtraPorts) []*toolspb.NmapExtraPorts {
+	var result []*toolspb.NmapExtraPorts
+	for _, extra := range extraPorts {
+		summary := &toolspb.NmapExtraPorts{
+			State: extra.State,
+			Count: parseInt32(extra.Count),
+		}
+		for _, reason := range extra.Reasons {
+			summary.Reasons = append(summary.Reasons, &toolspb.NmapExtraReason{
+				Reason:   reason.Reason,
+				Count:    parseInt32(reason.Count),
+				Protocol: reason.Proto,
+				Ports:    reason.Ports,
+			})
+		}
+		result = append(result, summary)
+	}
+	return result
+}
+
+// convertOSMatches converts nmap OS matches to proto, keeping nmap's accuracy ordering
+func convertOSMatches(matches []NmapOSMatch) []*toolspb.OSMatch {
+	var osMatches []*toolspb.OSMatch
+	for _, match := range matches {
+		osMatch := &toolspb.OSMatch{
+			Name:     match.Name,
+			Accuracy: parseInt32(match.Accuracy),
+		}
+		for _, class := range match.OSClasses {
+			osMatch.Classes = append(osMatch.Classes, &toolspb.OSClass{
+				Type:       class.Type,
+				Vendor:     class.Vendor,
+				Family:     class.Family,
+				Generation: class.OSGen,
+				Accuracy:   parseInt32(class.Accuracy),
+				Cpes:       class.CPE,
+			})
+		}
+		osMatches = append(osMatches, osMatch)
+	}
+	return osMatches
+}
+
+// parseInt32 parses a numeric XML attribute, returning 0 if it is absent or malformed
+func parseInt32(s string) int32 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(n)
+}
+
+// parseInt64 parses a numeric XML attribute, returning 0 if it is absent or malformed
+func parseInt64(s string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
 }
 
 // ptrStr returns a pointer to the given string
@@ -350,154 +693,222 @@ func ptrStr(s string) *string {
 	return &s
 }
 
-// convertToProtoResponse converts DiscoveryResult to NmapResponse
-func convertToProtoResponse(discoveryResult *graphragpb.DiscoveryResult, scanDuration float64, startTime time.Time) *toolspb.NmapResponse {
-	hosts := discoveryResult.Hosts
-	ports := discoveryResult.Ports
-	services := discoveryResult.Services
+// optStr returns a pointer to the given string, or nil if it is empty
+func optStr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
 
+// convertToProtoResponse converts a parsed nmap run to NmapResponse, attaching the
+// DiscoveryResult for automatic graph storage. targets are the requested scan
+// targets, used to attribute each host to the target(s) that produced it.
+func convertToProtoResponse(nmapRun *NmapRun, discoveryResult *graphragpb.DiscoveryResult, targets []string, scanDuration float64, startTime time.Time) *toolspb.NmapResponse {
 	response := &toolspb.NmapResponse{
-		TotalHosts:   int32(len(hosts)),
 		ScanDuration: scanDuration,
 		StartTime:    startTime.Unix(),
 		EndTime:      time.Now().Unix(),
 	}
 
-	// Count hosts that are up
-	hostsUp := int32(0)
-	for _, host := range hosts {
-		state := ""
-		if host.State != nil {
-			state = *host.State
-		}
-		if state == "up" {
-			hostsUp++
+	for _, host := range nmapRun.Hosts {
+		if hostIdentity(host) == "" {
+			continue
 		}
-	}
-	response.HostsUp = hostsUp
-	response.HostsDown = response.TotalHosts - hostsUp
 
-	// Convert graphrag hosts to nmap response hosts
-	for _, graphragHost := range hosts {
-		hostname := ""
-		if graphragHost.Hostname != nil {
-			hostname = *graphragHost.Hostname
+		mac, macVendor := hostMAC(host)
+		nmapHost := &toolspb.NmapHost{
+			Ip:             hostIP(host),
+			State:          host.Status.State,
+			StateReason:    host.Status.Reason,
+			StateReasonTtl: parseInt32(host.Status.ReasonTTL),
+			Mac:            mac,
+			MacVendor:      macVendor,
+			ExtraPorts:     convertExtraPorts(host.ExtraPorts),
 		}
-		state := ""
-		if graphragHost.State != nil {
-			state = *graphragHost.State
+		for _, addr := range host.Addresses {
+			nmapHost.Addresses = append(nmapHost.Addresses, &toolspb.NmapAddress{
+				Addr:     addr.Addr,
+				AddrType: addr.AddrType,
+				Vendor:   addr.Vendor,
+			})
 		}
-		os := ""
-		if graphragHost.Os != nil {
-			os = *graphragHost.Os
+		if len(host.Hostnames) > 0 {
+			nmapHost.Hostname = host.Hostnames[0].Name
 		}
-
-		nmapHost := &toolspb.NmapHost{
-			Ip:       graphragHost.Ip,
-			Hostname: hostname,
-			State:    state,
+		for _, hostname := range host.Hostnames {
+			nmapHost.Hostnames = append(nmapHost.Hostnames, &toolspb.NmapHostname{
+				Name: hostname.Name,
+				Type: hostname.Type,
+			})
+		}
+		nmapHost.Targets = matchTargets(host, targets)
+		nmapHost.Trace = convertTrace(host.Trace)
+		convertHostTiming(nmapHost, host)
+
+		// Add every OS match with its classes, plus the raw fingerprint if present
+		nmapHost.OsMatches = convertOSMatches(host.OS.OSMatches)
+		if len(host.OS.OSFingerprints) > 0 {
+			nmapHost.OsFingerprint = host.OS.OSFingerprints[0].Fingerprint
 		}
 
-		// Add OS information if available
-		if os != "" {
-			nmapHost.OsMatches = []*toolspb.OSMatch{
-				{
-					Name:     os,
-					Accuracy: 100, // Assuming high accuracy for simplicity
-				},
+		// Add ports with their service and script results
+		for _, port := range host.Ports {
+			nmapPort := &toolspb.NmapPort{
+				Number:    int32(port.PortID),
+				Protocol:  port.Protocol,
+				State:     port.State.State,
+				Reason:    port.State.Reason,
+				ReasonTtl: parseInt32(port.State.ReasonTTL),
+				ReasonIp:  port.State.ReasonIP,
 			}
+			if port.Service.Name != "" {
+				nmapPort.Service = convertService(port.Service)
+			}
+			for _, script := range port.Scripts {
+				nmapPort.Scripts = append(nmapPort.Scripts, convertScript(script))
+			}
+			nmapHost.Ports = append(nmapHost.Ports, nmapPort)
 		}
 
-		// Find and add ports for this host
-		for _, graphragPort := range ports {
-			if graphragPort.HostId == graphragHost.Ip {
-				portState := ""
-				if graphragPort.State != nil {
-					portState = *graphragPort.State
-				}
-				nmapPort := &toolspb.NmapPort{
-					Number:   graphragPort.Number,
-					Protocol: graphragPort.Protocol,
-					State:    portState,
-				}
-
-				// Find service for this port
-				portID := fmt.Sprintf("%s:%d:%s", graphragHost.Ip, graphragPort.Number, graphragPort.Protocol)
-				for _, graphragService := range services {
-					if graphragService.PortId == portID {
-						version := ""
-						if graphragService.Version != nil {
-							version = *graphragService.Version
-						}
-						nmapPort.Service = &toolspb.NmapService{
-							Name:    graphragService.Name,
-							Version: version,
-						}
-						break
-					}
-				}
-
-				nmapHost.Ports = append(nmapHost.Ports, nmapPort)
-			}
+		for _, script := range host.HostScripts {
+			nmapHost.Scripts = append(nmapHost.Scripts, convertScript(script))
 		}
 
+		if nmapHost.State == "up" {
+			response.HostsUp++
+		}
 		response.Hosts = append(response.Hosts, nmapHost)
 	}
 
+	for _, script := range nmapRun.PreScripts {
+		response.PreScripts = append(response.PreScripts, convertScript(script))
+	}
+	for _, script := range nmapRun.PostScripts {
+		response.PostScripts = append(response.PostScripts, convertScript(script))
+	}
+
+	response.TotalHosts = int32(len(response.Hosts))
+	response.HostsDown = response.TotalHosts - response.HostsUp
+
+	// Prefer nmap's own run metadata, timing and host counts where it reported them
+	applyRunInfo(response, nmapRun)
+
 	// Populate discovery field for automatic graph storage
 	response.Discovery = discoveryResult
 
 	return response
 }
 
-// classifyExecutionError determines the error class based on the underlying error
-func classifyExecutionError(err error) toolerr.ErrorClass {
+// Reason codes for execution failures. They are reported as the error code so
+// the worker can decide whether to retry without parsing messages; failures
+// nmap explained on stderr use the diagnostic's code in upper case instead.
+const (
+	reasonBinaryNotFound   = "BINARY_NOT_FOUND"
+	reasonNotExecutable    = "BINARY_NOT_EXECUTABLE"
+	reasonPermissionDenied = "PERMISSION_DENIED"
+	reasonTimeout          = "TIMEOUT"
+	reasonCancelled        = "CANCELLED"
+	reasonKilled           = "KILLED_BY_SIGNAL"
+	reasonExitStatus       = "NMAP_EXIT_STATUS"
+	reasonNmapError        = "NMAP_ERROR"
+	reasonUnknown          = toolerr.ErrCodeExecutionFailed
+)
+
+// errNmapReported marks an error nmap reported in its XML run stats
+var errNmapReported = errors.New("nmap reported an error")
+
+// executionError wraps a failed nmap run as a tool error, with the reason code
+// from classifyExecutionError as its error code
+func executionError(msg string, err error) error {
+	class, reason := classifyExecutionError(err)
+	return toolerr.New(ToolName, "execute", reason, msg).
+		WithCause(err).
+		WithClass(class)
+}
+
+// classifyExecutionError determines the error class and reason code from the
+// type of the underlying error, never from its message, so target names and
+// nmap's output cannot change the outcome
+func classifyExecutionError(err error) (toolerr.ErrorClass, string) {
 	if err == nil {
-		return toolerr.ErrorClassTransient
+		return toolerr.ErrorClassTransient, reasonUnknown
 	}
 
-	errMsg := err.Error()
-
-	// Check for binary not found errors
-	if strings.Contains(errMsg, "not found") || strings.Contains(errMsg, "executable file not found") {
-		return toolerr.ErrorClassInfrastructure
+	// The binary could not be started
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return toolerr.ErrorClassInfrastructure, reasonBinaryNotFound
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return toolerr.ErrorClassInfrastructure, reasonPermissionDenied
 	}
 
-	// Check for timeout errors
-	if strings.Contains(errMsg, "timed out") || strings.Contains(errMsg, "timeout") ||
-		strings.Contains(errMsg, "deadline exceeded") {
-		return toolerr.ErrorClassTransient
+	if errors.Is(err, context.DeadlineExceeded) {
+		return toolerr.ErrorClassTransient, reasonTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return toolerr.ErrorClassTransient, reasonCancelled
 	}
 
-	// Check for permission errors
-	if strings.Contains(errMsg, "permission denied") || strings.Contains(errMsg, "access denied") {
-		return toolerr.ErrorClassInfrastructure
+	// Errors nmap explained on stderr carry their own class
+	var stderrErr *stderrError
+	if errors.As(err, &stderrErr) {
+		return stderrErr.Diagnostic.Class, strings.ToUpper(stderrErr.Diagnostic.reason())
 	}
 
-	// Check for network errors
-	if strings.Contains(errMsg, "network") || strings.Contains(errMsg, "connection") ||
-		strings.Contains(errMsg, "host unreachable") || strings.Contains(errMsg, "no route to host") {
-		return toolerr.ErrorClassTransient
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case -1:
+			// Killed by a signal, e.g. by the OOM killer
+			return toolerr.ErrorClassTransient, reasonKilled
+		case 126:
+			// Reported by sudo or a shell that could not run nmap
+			return toolerr.ErrorClassInfrastructure, reasonNotExecutable
+		case 127:
+			return toolerr.ErrorClassInfrastructure, reasonBinaryNotFound
+		default:
+			// nmap failed without saying why on stderr
+			return toolerr.ErrorClassTransient, reasonExitStatus
+		}
 	}
 
-	// Check for cancellation
-	if strings.Contains(errMsg, "cancelled") || strings.Contains(errMsg, "canceled") {
-		return toolerr.ErrorClassTransient
+	// nmap's own errors are about the request: bad targets or options
+	if errors.Is(err, errNmapReported) {
+		return toolerr.ErrorClassSemantic, reasonNmapError
 	}
 
 	// Default to transient for unknown execution errors
-	return toolerr.ErrorClassTransient
+	return toolerr.ErrorClassTransient, reasonUnknown
 }
 
-// validateFlags checks if any requested flags are blocked by capabilities.
-// Returns the blocked flag, its alternative (if available), and whether a block was found.
-func validateFlags(caps *types.Capabilities, flags []string) (blockedFlag string, alternative string, blocked bool) {
-	for _, flag := range flags {
-		if caps.IsArgBlocked(flag) {
-			alt, _ := caps.GetAlternative(flag)
-			return flag, alt, true
+// validateFlags checks if any parsed options, including implied ones, are blocked by capabilities.
+// Returns the blocked option, its alternative (if available), and whether a block was found.
+func validateFlags(caps *types.Capabilities, args *nmapArgs) (blockedOption nmapOption, alternative string, blocked bool) {
+	for _, option := range args.Options {
+		if caps.IsArgBlocked(option.Name) {
+			alt, _ := caps.GetAlternative(option.Name)
+			return option, alt, true
 		}
 	}
-	return "", "", false
+	return nmapOption{}, "", false
 }
 
+// checkPrivileges returns a validation error if the arguments need privileges the tool lacks
+func checkPrivileges(caps *types.Capabilities, args *nmapArgs) error {
+	if caps == nil {
+		return nil
+	}
+	option, alternative, blocked := validateFlags(caps, args)
+	if !blocked {
+		return nil
+	}
+
+	errMsg := fmt.Sprintf("flag %s requires elevated privileges and is blocked", option)
+	if alternative != "" {
+		errMsg = fmt.Sprintf("%s. Try using '%s' instead", errMsg, alternative)
+	}
+	errMsg += ". Set auto_downgrade to rewrite blocked flags automatically"
+	return toolerr.New(ToolName, "validate", toolerr.ErrCodeInvalidInput, errMsg).
+		WithClass(toolerr.ErrorClassSemantic)
+}
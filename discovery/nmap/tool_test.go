@@ -3,96 +3,126 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/zero-day-ai/sdk/api/gen/toolspb"
 	"github.com/zero-day-ai/sdk/toolerr"
 )
 
+// exitError runs a shell script and returns the *exec.ExitError it fails with
+func exitError(t *testing.T, script string) error {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	err := exec.Command("sh", "-c", script).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an exit error, got %v", err)
+	}
+	return err
+}
+
 func TestClassifyExecutionError(t *testing.T) {
+	deviceErr := &stderrError{
+		Diagnostic: classifyLines("Failed to open device eth7\nQUITTING!\n")[1],
+		Err:        errors.New("exit status 1"),
+	}
+
 	tests := []struct {
-		name     string
-		err      error
-		expected toolerr.ErrorClass
+		name           string
+		err            error
+		expected       toolerr.ErrorClass
+		expectedReason string
 	}{
 		{
-			name:     "binary not found",
-			err:      errors.New("exec: \"nmap\": executable file not found in $PATH"),
-			expected: toolerr.ErrorClassInfrastructure,
-		},
-		{
-			name:     "binary not found alternative",
-			err:      errors.New("nmap not found"),
-			expected: toolerr.ErrorClassInfrastructure,
-		},
-		{
-			name:     "timeout error",
-			err:      errors.New("command timed out after 30s"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "binary not found",
+			err:            &exec.Error{Name: "nmap", Err: exec.ErrNotFound},
+			expected:       toolerr.ErrorClassInfrastructure,
+			expectedReason: reasonBinaryNotFound,
 		},
 		{
-			name:     "deadline exceeded",
-			err:      errors.New("context deadline exceeded"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "binary path missing",
+			err:            &fs.PathError{Op: "fork/exec", Path: "/usr/bin/nmap", Err: syscall.ENOENT},
+			expected:       toolerr.ErrorClassInfrastructure,
+			expectedReason: reasonBinaryNotFound,
 		},
 		{
-			name:     "permission denied",
-			err:      errors.New("permission denied: requires root"),
-			expected: toolerr.ErrorClassInfrastructure,
+			name:           "permission denied",
+			err:            &fs.PathError{Op: "fork/exec", Path: "/usr/bin/nmap", Err: syscall.EACCES},
+			expected:       toolerr.ErrorClassInfrastructure,
+			expectedReason: reasonPermissionDenied,
 		},
 		{
-			name:     "access denied",
-			err:      errors.New("access denied"),
-			expected: toolerr.ErrorClassInfrastructure,
+			name:           "deadline exceeded",
+			err:            fmt.Errorf("scan: %w", context.DeadlineExceeded),
+			expected:       toolerr.ErrorClassTransient,
+			expectedReason: reasonTimeout,
 		},
 		{
-			name:     "network error",
-			err:      errors.New("network unreachable"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "canceled",
+			err:            context.Canceled,
+			expected:       toolerr.ErrorClassTransient,
+			expectedReason: reasonCancelled,
 		},
 		{
-			name:     "connection error",
-			err:      errors.New("connection refused"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "explained on stderr",
+			err:            deviceErr,
+			expected:       toolerr.ErrorClassInfrastructure,
+			expectedReason: "DEVICE_UNAVAILABLE",
 		},
 		{
-			name:     "host unreachable",
-			err:      errors.New("host unreachable"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "nonzero exit",
+			err:            exitError(t, "exit 1"),
+			expected:       toolerr.ErrorClassTransient,
+			expectedReason: reasonExitStatus,
 		},
 		{
-			name:     "no route to host",
-			err:      errors.New("no route to host"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "command not found through sudo",
+			err:            exitError(t, "exit 127"),
+			expected:       toolerr.ErrorClassInfrastructure,
+			expectedReason: reasonBinaryNotFound,
 		},
 		{
-			name:     "cancelled",
-			err:      errors.New("command cancelled"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "killed by signal",
+			err:            exitError(t, "kill -9 $$"),
+			expected:       toolerr.ErrorClassTransient,
+			expectedReason: reasonKilled,
 		},
 		{
-			name:     "canceled",
-			err:      errors.New("context canceled"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "target named like an infrastructure failure",
+			err:            fmt.Errorf("%w: Failed to resolve \"notfound.local\" (network not found)", errNmapReported),
+			expected:       toolerr.ErrorClassSemantic,
+			expectedReason: reasonNmapError,
 		},
 		{
-			name:     "unknown error",
-			err:      errors.New("some unknown error occurred"),
-			expected: toolerr.ErrorClassTransient,
+			name:           "message alone does not classify",
+			err:            errors.New("exec: \"nmap\": executable file not found in $PATH"),
+			expected:       toolerr.ErrorClassTransient,
+			expectedReason: reasonUnknown,
 		},
 		{
-			name:     "nil error",
-			err:      nil,
-			expected: toolerr.ErrorClassTransient,
+			name:           "nil error",
+			err:            nil,
+			expected:       toolerr.ErrorClassTransient,
+			expectedReason: reasonUnknown,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := classifyExecutionError(tt.err)
+			got, reason := classifyExecutionError(tt.err)
 			if got != tt.expected {
 				t.Errorf("classifyExecutionError() = %v, want %v", got, tt.expected)
 			}
+			if reason != tt.expectedReason {
+				t.Errorf("classifyExecutionError() reason = %q, want %q", reason, tt.expectedReason)
+			}
 		})
 	}
 }
@@ -338,6 +368,14 @@ func TestValidation(t *testing.T) {
 			expectError: true,
 			errorMsg:    "at least one argument is required",
 		},
+		{
+			name: "structured options without args",
+			request: &toolspb.NmapRequest{
+				Targets:  []string{"192.168.1.1"},
+				ScanType: toolspb.ScanType_SCAN_TYPE_PING,
+			},
+			expectError: false,
+		},
 		{
 			name: "multiple targets",
 			request: &toolspb.NmapRequest{
@@ -379,3 +417,304 @@ func TestValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertOSMatches(t *testing.T) {
+	osXML := []byte(`<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up"/>
+		<address addr="192.168.1.1" addrtype="ipv4"/>
+		<os>
+			<osmatch name="Linux 5.0 - 5.4" accuracy="96">
+				<osclass type="general purpose" vendor="Linux" osfamily="Linux" osgen="5.X" accuracy="96">
+					<cpe>cpe:/o:linux:linux_kernel:5</cpe>
+				</osclass>
+			</osmatch>
+			<osmatch name="Linux 2.6.32 (embedded)" accuracy="85">
+				<osclass type="WAP" vendor="Linux" osfamily="Linux" osgen="2.6.X" accuracy="85">
+					<cpe>cpe:/o:linux:linux_kernel:2.6.32</cpe>
+				</osclass>
+				<osclass type="router" vendor="MikroTik" osfamily="RouterOS" osgen="6.X" accuracy="85">
+					<cpe>cpe:/o:mikrotik:routeros:6</cpe>
+				</osclass>
+			</osmatch>
+			<osfingerprint fingerprint="OS:SCAN(V=7.94%E=4%D=1/1)"/>
+		</os>
+	</host>
+</nmaprun>`)
+
+	nmapRun, err := parseNmapRun(osXML)
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+	host := response.Hosts[0]
+
+	if len(host.OsMatches) != 2 {
+		t.Fatalf("expected 2 OS matches, got %d", len(host.OsMatches))
+	}
+
+	best := host.OsMatches[0]
+	if best.Name != "Linux 5.0 - 5.4" || best.Accuracy != 96 {
+		t.Errorf("expected 'Linux 5.0 - 5.4' at 96, got %q at %d", best.Name, best.Accuracy)
+	}
+	if len(best.Classes) != 1 {
+		t.Fatalf("expected 1 OS class, got %d", len(best.Classes))
+	}
+
+	class := best.Classes[0]
+	if class.Family != "Linux" || class.Generation != "5.X" || class.Type != "general purpose" || class.Accuracy != 96 {
+		t.Errorf("unexpected OS class: %+v", class)
+	}
+	if len(class.Cpes) != 1 || class.Cpes[0] != "cpe:/o:linux:linux_kernel:5" {
+		t.Errorf("expected linux kernel CPE, got %v", class.Cpes)
+	}
+
+	embedded := host.OsMatches[1]
+	if embedded.Accuracy != 85 || len(embedded.Classes) != 2 {
+		t.Errorf("expected embedded match at 85 with 2 classes, got %d with %d", embedded.Accuracy, len(embedded.Classes))
+	}
+	if embedded.Classes[1].Vendor != "MikroTik" {
+		t.Errorf("expected second class vendor=MikroTik, got %q", embedded.Classes[1].Vendor)
+	}
+
+	if host.OsFingerprint != "OS:SCAN(V=7.94%E=4%D=1/1)" {
+		t.Errorf("expected OS fingerprint, got %q", host.OsFingerprint)
+	}
+}
+
+func TestServiceDetail(t *testing.T) {
+	serviceXML := []byte(`<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up"/>
+		<address addr="192.168.1.1" addrtype="ipv4"/>
+		<ports>
+			<port protocol="tcp" portid="8443">
+				<state state="open"/>
+				<service name="http" product="Apache httpd" version="2.4.52" extrainfo="(Ubuntu)" ostype="Linux" hostname="web01" tunnel="ssl" method="probed" conf="10">
+					<cpe>cpe:/a:apache:http_server:2.4.52</cpe>
+					<cpe>cpe:/o:linux:linux_kernel</cpe>
+				</service>
+			</port>
+			<port protocol="tcp" portid="3389">
+				<state state="filtered"/>
+				<service name="ms-wbt-server" method="table" conf="3"/>
+			</port>
+		</ports>
+	</host>
+</nmaprun>`)
+
+	nmapRun, err := parseNmapRun(serviceXML)
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	t.Run("response carries service detail", func(t *testing.T) {
+		response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+
+		service := response.Hosts[0].Ports[0].Service
+		if service.Tunnel != "ssl" || service.Method != "probed" || service.Confidence != 10 {
+			t.Errorf("expected ssl/probed/10, got %q/%q/%d", service.Tunnel, service.Method, service.Confidence)
+		}
+		if service.Product != "Apache httpd" || service.ExtraInfo != "(Ubuntu)" || service.OsType != "Linux" || service.Hostname != "web01" {
+			t.Errorf("unexpected service detail: %+v", service)
+		}
+		if service.Version != "Apache httpd 2.4.52" {
+			t.Errorf("expected version='Apache httpd 2.4.52', got %q", service.Version)
+		}
+		if len(service.Cpes) != 2 || service.Cpes[0] != "cpe:/a:apache:http_server:2.4.52" {
+			t.Errorf("expected 2 CPEs, got %v", service.Cpes)
+		}
+
+		guessed := response.Hosts[0].Ports[1].Service
+		if guessed.Method != "table" || guessed.Confidence != 3 {
+			t.Errorf("expected table/3, got %q/%d", guessed.Method, guessed.Confidence)
+		}
+	})
+
+	t.Run("graph service carries service detail", func(t *testing.T) {
+		result := buildDiscoveryResult(nmapRun)
+
+		service := result.Services[0]
+		if service.Tunnel == nil || *service.Tunnel != "ssl" {
+			t.Errorf("expected tunnel=ssl, got %v", service.Tunnel)
+		}
+		if service.Confidence == nil || *service.Confidence != 10 {
+			t.Errorf("expected confidence=10, got %v", service.Confidence)
+		}
+		if len(service.Cpes) != 2 {
+			t.Errorf("expected 2 CPEs, got %v", service.Cpes)
+		}
+
+		guessed := result.Services[1]
+		if guessed.Version != nil || guessed.Product != nil {
+			t.Errorf("expected no version or product for table guess, got %v/%v", guessed.Version, guessed.Product)
+		}
+		if guessed.Method == nil || *guessed.Method != "table" {
+			t.Errorf("expected method=table, got %v", guessed.Method)
+		}
+	})
+}
+
+func TestHostAddresses(t *testing.T) {
+	addressXML := []byte(`<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up"/>
+		<address addr="fe80::1" addrtype="ipv6"/>
+		<address addr="192.168.1.1" addrtype="ipv4"/>
+		<address addr="00:11:22:33:44:55" addrtype="mac" vendor="Cisco Systems"/>
+		<ports>
+			<port protocol="tcp" portid="22">
+				<state state="open"/>
+			</port>
+		</ports>
+	</host>
+	<host>
+		<status state="up"/>
+		<address addr="AA:BB:CC:DD:EE:FF" addrtype="mac" vendor="Raspberry Pi Foundation"/>
+		<ports>
+			<port protocol="tcp" portid="80">
+				<state state="open"/>
+			</port>
+		</ports>
+	</host>
+	<host>
+		<status state="up"/>
+		<address addr="2001:db8::10" addrtype="ipv6"/>
+	</host>
+</nmaprun>`)
+
+	nmapRun, err := parseNmapRun(addressXML)
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	t.Run("identity is stable and MAC-only hosts are kept", func(t *testing.T) {
+		tests := []struct {
+			host     NmapHost
+			expected string
+		}{
+			{nmapRun.Hosts[0], "192.168.1.1"},
+			{nmapRun.Hosts[1], "AA:BB:CC:DD:EE:FF"},
+			{nmapRun.Hosts[2], "2001:db8::10"},
+		}
+		for _, tt := range tests {
+			if got := hostIdentity(tt.host); got != tt.expected {
+				t.Errorf("hostIdentity() = %q, want %q", got, tt.expected)
+			}
+		}
+	})
+
+	t.Run("graph host carries all addresses and MAC", func(t *testing.T) {
+		result := buildDiscoveryResult(nmapRun)
+
+		if len(result.Hosts) != 3 {
+			t.Fatalf("expected 3 hosts, got %d", len(result.Hosts))
+		}
+
+		host := result.Hosts[0]
+		if host.Ip != "192.168.1.1" {
+			t.Errorf("expected ip=192.168.1.1, got %q", host.Ip)
+		}
+		if host.Mac == nil || *host.Mac != "00:11:22:33:44:55" {
+			t.Errorf("expected mac=00:11:22:33:44:55, got %v", host.Mac)
+		}
+		if host.MacVendor == nil || *host.MacVendor != "Cisco Systems" {
+			t.Errorf("expected vendor='Cisco Systems', got %v", host.MacVendor)
+		}
+		if len(host.Addresses) != 3 {
+			t.Errorf("expected 3 addresses, got %v", host.Addresses)
+		}
+		if result.Ports[0].HostId != "192.168.1.1" {
+			t.Errorf("expected port hostID=192.168.1.1, got %q", result.Ports[0].HostId)
+		}
+
+		macOnly := result.Hosts[1]
+		if macOnly.Ip != "" || macOnly.Mac == nil || *macOnly.Mac != "AA:BB:CC:DD:EE:FF" {
+			t.Errorf("expected MAC-only host identified by its MAC alone, got ip=%q mac=%v", macOnly.Ip, macOnly.Mac)
+		}
+		if len(result.Ports) != 2 || result.Ports[1].HostId != "AA:BB:CC:DD:EE:FF" {
+			t.Errorf("expected the MAC-only host's port to refer to its MAC, got %+v", result.Ports)
+		}
+	})
+
+	t.Run("response host carries all addresses and MAC", func(t *testing.T) {
+		response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+
+		if response.TotalHosts != 3 {
+			t.Fatalf("expected 3 hosts, got %d", response.TotalHosts)
+		}
+
+		host := response.Hosts[0]
+		if host.Ip != "192.168.1.1" || host.Mac != "00:11:22:33:44:55" || host.MacVendor != "Cisco Systems" {
+			t.Errorf("unexpected host addressing: ip=%q mac=%q vendor=%q", host.Ip, host.Mac, host.MacVendor)
+		}
+		if len(host.Addresses) != 3 || host.Addresses[0].AddrType != "ipv6" {
+			t.Errorf("expected all 3 addresses in nmap order, got %+v", host.Addresses)
+		}
+
+		macOnly := response.Hosts[1]
+		if macOnly.Ip != "" || macOnly.Mac != "AA:BB:CC:DD:EE:FF" {
+			t.Errorf("expected MAC-only host without ip, got ip=%q mac=%q", macOnly.Ip, macOnly.Mac)
+		}
+	})
+}
+
+func TestPortReasonsAndExtraPorts(t *testing.T) {
+	reasonXML := []byte(`<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up" reason="echo-reply" reason_ttl="63"/>
+		<address addr="192.168.1.1" addrtype="ipv4"/>
+		<ports>
+			<extraports state="filtered" count="995">
+				<extrareasons reason="no-response" count="990" proto="tcp" ports="1-21,23-79"/>
+				<extrareasons reason="admin-prohibited" count="5" proto="tcp" ports="135-139"/>
+			</extraports>
+			<port protocol="tcp" portid="22">
+				<state state="open" reason="syn-ack" reason_ttl="63"/>
+			</port>
+			<port protocol="tcp" portid="25">
+				<state state="closed" reason="reset" reason_ttl="254" reason_ip="192.168.1.254"/>
+			</port>
+		</ports>
+	</host>
+</nmaprun>`)
+
+	nmapRun, err := parseNmapRun(reasonXML)
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+	host := response.Hosts[0]
+
+	if host.StateReason != "echo-reply" || host.StateReasonTtl != 63 {
+		t.Errorf("expected host reason echo-reply/63, got %q/%d", host.StateReason, host.StateReasonTtl)
+	}
+
+	open := host.Ports[0]
+	if open.Reason != "syn-ack" || open.ReasonTtl != 63 || open.ReasonIp != "" {
+		t.Errorf("unexpected open port reason: %q/%d/%q", open.Reason, open.ReasonTtl, open.ReasonIp)
+	}
+
+	// A reset from a different TTL and IP than the host points at a firewall
+	closed := host.Ports[1]
+	if closed.Reason != "reset" || closed.ReasonTtl != 254 || closed.ReasonIp != "192.168.1.254" {
+		t.Errorf("unexpected closed port reason: %q/%d/%q", closed.Reason, closed.ReasonTtl, closed.ReasonIp)
+	}
+
+	if len(host.ExtraPorts) != 1 {
+		t.Fatalf("expected 1 extraports summary, got %d", len(host.ExtraPorts))
+	}
+	extra := host.ExtraPorts[0]
+	if extra.State != "filtered" || extra.Count != 995 || len(extra.Reasons) != 2 {
+		t.Errorf("unexpected extraports summary: %+v", extra)
+	}
+	if reason := extra.Reasons[1]; reason.Reason != "admin-prohibited" || reason.Count != 5 || reason.Protocol != "tcp" || reason.Ports != "135-139" {
+		t.Errorf("unexpected extrareasons entry: %+v", reason)
+	}
+}
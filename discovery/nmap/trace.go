@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/zero-day-ai/sdk/api/gen/graphragpb"
+	"github.com/zero-day-ai/sdk/api/gen/toolspb"
+)
+
+// Graph vocabulary for traceroute topology. Hops are modelled as host nodes
+// linked in TTL order, ending at the scanned host.
+const (
+	hostNodeType             = "host"
+	nextHopRelationshipType  = "NEXT_HOP"
+	traceHopPropertyTTL      = "ttl"
+	traceHopPropertyRTT      = "rtt"
+	traceHopPropertyProtocol = "protocol"
+)
+
+// convertTrace converts traceroute results to proto, or returns nil if no trace was run
+func convertTrace(trace *NmapTrace) *toolspb.NmapTrace {
+	if trace == nil {
+		return nil
+	}
+
+	nmapTrace := &toolspb.NmapTrace{
+		Port:     int32(trace.Port),
+		Protocol: trace.Protocol,
+	}
+	for _, hop := range trace.Hops {
+		rtt, _ := strconv.ParseFloat(hop.RTT, 64)
+		nmapTrace.Hops = append(nmapTrace.Hops, &toolspb.NmapHop{
+			Ttl:  int32(hop.TTL),
+			Ip:   hop.IPAddr,
+			Rtt:  rtt,
+			Host: hop.Host,
+		})
+	}
+	return nmapTrace
+}
+
+// traceGraph accumulates router nodes and path edges across all hosts of a scan.
+// Paths to different targets usually share their first hops, so nodes and
+// edges are de-duplicated.
+type traceGraph struct {
+	seenHosts map[string]bool
+	seenEdges map[string]bool
+}
+
+// newTraceGraph creates a traceGraph that treats the given host nodes as already
+// present in the result, so scanned hosts seen as hops are not emitted twice
+func newTraceGraph(hosts []*graphragpb.Host) *traceGraph {
+	g := &traceGraph{
+		seenHosts: make(map[string]bool, len(hosts)),
+		seenEdges: make(map[string]bool),
+	}
+	for _, host := range hosts {
+		if host.Ip != "" {
+			g.seenHosts[host.Ip] = true
+		}
+	}
+	return g
+}
+
+// add appends router nodes and NEXT_HOP edges for one host's trace to result.
+// The path ends at targetID, the scanned host.
+func (g *traceGraph) add(result *graphragpb.DiscoveryResult, trace *NmapTrace, targetID string) {
+	prevID := ""
+	for _, hop := range trace.Hops {
+		if hop.IPAddr == "" {
+			continue
+		}
+
+		// The final hop is the target itself; it already has a host node
+		if hop.IPAddr != targetID && !g.seenHosts[hop.IPAddr] {
+			g.seenHosts[hop.IPAddr] = true
+			result.Hosts = append(result.Hosts, &graphragpb.Host{
+				Ip:       hop.IPAddr,
+				Hostname: optStr(hop.Host),
+			})
+		}
+
+		if prevID != "" && prevID != hop.IPAddr {
+			g.addEdge(result, prevID, hop.IPAddr, trace.Protocol, hop)
+		}
+		prevID = hop.IPAddr
+	}
+
+	// Link the last responding hop to the target if the trace stopped short of it
+	if prevID != "" && prevID != targetID {
+		g.addEdge(result, prevID, targetID, trace.Protocol, NmapHop{})
+	}
+}
+
+// addEdge appends a NEXT_HOP edge between two host nodes unless it already exists.
+// The edge carries the TTL and RTT of the hop it leads to, when known.
+func (g *traceGraph) addEdge(result *graphragpb.DiscoveryResult, fromID, toID, protocol string, hop NmapHop) {
+	key := fromID + "->" + toID
+	if g.seenEdges[key] {
+		return
+	}
+	g.seenEdges[key] = true
+
+	properties := make(map[string]string)
+	if protocol != "" {
+		properties[traceHopPropertyProtocol] = protocol
+	}
+	if hop.TTL > 0 {
+		properties[traceHopPropertyTTL] = strconv.Itoa(hop.TTL)
+	}
+	if hop.RTT != "" {
+		properties[traceHopPropertyRTT] = hop.RTT
+	}
+
+	result.Relationships = append(result.Relationships, &graphragpb.Relationship{
+		FromType:   hostNodeType,
+		FromId:     fromID,
+		ToType:     hostNodeType,
+		ToId:       toID,
+		Type:       nextHopRelationshipType,
+		Properties: properties,
+	})
+}
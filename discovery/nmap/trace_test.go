@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+const traceXML = `<?xml version="1.0"?>
+<nmaprun>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.2.10" addrtype="ipv4"/>
+		<trace port="80" proto="tcp">
+			<hop ttl="1" ipaddr="192.168.1.1" rtt="0.52" host="gw.local"/>
+			<hop ttl="2" ipaddr="10.0.0.1" rtt="3.10"/>
+			<hop ttl="3" ipaddr="10.0.2.10" rtt="4.25"/>
+		</trace>
+	</host>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.3.20" addrtype="ipv4"/>
+		<trace port="443" proto="tcp">
+			<hop ttl="1" ipaddr="192.168.1.1" rtt="0.48" host="gw.local"/>
+			<hop ttl="2" ipaddr="10.0.0.1" rtt="3.01"/>
+			<hop ttl="4" ipaddr="10.0.3.1" rtt="6.70"/>
+		</trace>
+	</host>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.4.5" addrtype="ipv4"/>
+	</host>
+</nmaprun>`
+
+func TestConvertTrace(t *testing.T) {
+	nmapRun, err := parseNmapRun([]byte(traceXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 1, time.Now())
+
+	trace := response.Hosts[0].Trace
+	if trace == nil {
+		t.Fatal("expected trace on first host")
+	}
+	if trace.Port != 80 || trace.Protocol != "tcp" {
+		t.Errorf("expected trace via 80/tcp, got %d/%s", trace.Port, trace.Protocol)
+	}
+	if len(trace.Hops) != 3 {
+		t.Fatalf("expected 3 hops, got %d", len(trace.Hops))
+	}
+
+	hop := trace.Hops[0]
+	if hop.Ttl != 1 || hop.Ip != "192.168.1.1" || hop.Rtt != 0.52 || hop.Host != "gw.local" {
+		t.Errorf("unexpected first hop: %+v", hop)
+	}
+
+	if response.Hosts[2].Trace != nil {
+		t.Errorf("expected no trace for host scanned without --traceroute, got %+v", response.Hosts[2].Trace)
+	}
+}
+
+func TestTraceTopology(t *testing.T) {
+	result, err := parseOutput([]byte(traceXML))
+	if err != nil {
+		t.Fatalf("unexpected error parsing XML: %v", err)
+	}
+
+	t.Run("router nodes are de-duplicated", func(t *testing.T) {
+		// 3 scanned hosts + 3 distinct routers (192.168.1.1, 10.0.0.1, 10.0.3.1)
+		if len(result.Hosts) != 6 {
+			t.Fatalf("expected 6 host nodes, got %d", len(result.Hosts))
+		}
+
+		hostnames := make(map[string]string)
+		for _, host := range result.Hosts {
+			if host.Hostname != nil {
+				hostnames[host.Ip] = *host.Hostname
+			}
+		}
+		if hostnames["192.168.1.1"] != "gw.local" {
+			t.Errorf("expected router hostname gw.local, got %q", hostnames["192.168.1.1"])
+		}
+	})
+
+	t.Run("path edges link hops to the target", func(t *testing.T) {
+		edges := make(map[string]map[string]string)
+		for _, rel := range result.Relationships {
+			if rel.Type != nextHopRelationshipType {
+				t.Errorf("unexpected relationship type %q", rel.Type)
+			}
+			edges[rel.FromId+"->"+rel.ToId] = rel.Properties
+		}
+
+		expected := []string{
+			"192.168.1.1->10.0.0.1",
+			"10.0.0.1->10.0.2.10",
+			"10.0.0.1->10.0.3.1",
+			"10.0.3.1->10.0.3.20",
+		}
+		if len(edges) != len(expected) || len(result.Relationships) != len(expected) {
+			t.Errorf("expected %d unique edges, got %v", len(expected), edges)
+		}
+		for _, key := range expected {
+			if _, ok := edges[key]; !ok {
+				t.Errorf("missing edge %s", key)
+			}
+		}
+
+		if props := edges["10.0.0.1->10.0.2.10"]; props[traceHopPropertyTTL] != "3" || props[traceHopPropertyRTT] != "4.25" {
+			t.Errorf("expected ttl=3 rtt=4.25 on final edge, got %v", props)
+		}
+		if props := edges["10.0.3.1->10.0.3.20"]; props[traceHopPropertyTTL] != "" {
+			t.Errorf("expected no ttl on inferred edge to unreached target, got %v", props)
+		}
+	})
+}
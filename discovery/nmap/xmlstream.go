@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// nmapScriptList is the container used by <prescript> and <postscript>
+type nmapScriptList struct {
+	Scripts []NmapScript `xml:"script"`
+}
+
+// parseNmapStream incrementally decodes nmap XML output from r. Each <host> is
+// decoded as soon as its closing tag arrives and passed to onHost (if non-nil)
+// before the rest of the document is read, so callers can act on early hosts
+// while nmap is still scanning.
+//
+// Output that stops or breaks after the <nmaprun> root has started is not an
+// error: everything decoded up to that point is returned with Truncated set,
+// so interrupted scans keep every host nmap finished. An error is returned
+// only if no <nmaprun> document was found at all.
+func parseNmapStream(r io.Reader, onHost func(host NmapHost)) (*NmapRun, error) {
+	return parseNmapStreamEvents(r, onHost, nil)
+}
+
+// parseNmapStreamEvents is parseNmapStream that also passes nmap's task events
+// (taskbegin, taskprogress, taskend) to onTask, if non-nil, as they arrive
+func parseNmapStreamEvents(r io.Reader, onHost func(host NmapHost), onTask func(event NmapTaskEvent)) (*NmapRun, error) {
+	nmapRun := &NmapRun{}
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return endNmapStream(nmapRun, err)
+		}
+
+		if end, ok := token.(xml.EndElement); ok && end.Name.Local == "nmaprun" {
+			return nmapRun, nil
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if nmapRun.XMLName.Local == "" && start.Name.Local != "nmaprun" {
+			return nmapRun, fmt.Errorf("failed to parse nmap XML: expected <nmaprun>, found <%s>", start.Name.Local)
+		}
+
+		switch start.Name.Local {
+		case "nmaprun":
+			// Root element: record its attributes and descend into its children
+			nmapRun.XMLName = start.Name
+			for _, attr := range start.Attr {
+				switch attr.Name.Local {
+				case "scanner":
+					nmapRun.Scanner = attr.Value
+				case "version":
+					nmapRun.Version = attr.Value
+				case "args":
+					nmapRun.Args = attr.Value
+				case "start":
+					nmapRun.Start = attr.Value
+				case "xmloutputversion":
+					nmapRun.XMLOutputVersion = attr.Value
+				}
+			}
+
+		case "host":
+			var host NmapHost
+			if err := decoder.DecodeElement(&host, &start); err != nil {
+				// A host cut off mid-element is dropped; the completed ones are kept
+				return endNmapStream(nmapRun, err)
+			}
+			nmapRun.Hosts = append(nmapRun.Hosts, host)
+			if onHost != nil {
+				onHost(host)
+			}
+
+		case "scaninfo":
+			var info NmapScanInfo
+			err = decoder.DecodeElement(&info, &start)
+			nmapRun.ScanInfo = append(nmapRun.ScanInfo, info)
+
+		case "prescript":
+			var scripts nmapScriptList
+			err = decoder.DecodeElement(&scripts, &start)
+			nmapRun.PreScripts = append(nmapRun.PreScripts, scripts.Scripts...)
+
+		case "postscript":
+			var scripts nmapScriptList
+			err = decoder.DecodeElement(&scripts, &start)
+			nmapRun.PostScripts = append(nmapRun.PostScripts, scripts.Scripts...)
+
+		case "runstats":
+			err = decoder.DecodeElement(&nmapRun.RunStats, &start)
+
+		case "taskbegin", "taskprogress", "taskend":
+			var event NmapTaskEvent
+			err = decoder.DecodeElement(&event, &start)
+			if err == nil && onTask != nil {
+				onTask(event)
+			}
+
+		default:
+			// verbose, debugging, hosthint, output, ...
+			err = decoder.Skip()
+		}
+
+		if err != nil {
+			return endNmapStream(nmapRun, err)
+		}
+	}
+}
+
+// endNmapStream finishes a parse that stopped before </nmaprun>. Once the root
+// element has been seen the run is kept and flagged as truncated; before that
+// there is nothing to salvage.
+func endNmapStream(nmapRun *NmapRun, err error) (*NmapRun, error) {
+	if nmapRun.XMLName.Local == "" {
+		if err == io.EOF {
+			return nmapRun, fmt.Errorf("failed to parse nmap XML: no nmaprun element found")
+		}
+		return nmapRun, fmt.Errorf("failed to parse nmap XML: %w", err)
+	}
+	nmapRun.Truncated = true
+	return nmapRun, nil
+}
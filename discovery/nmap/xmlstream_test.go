@@ -0,0 +1,261 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const streamXML = `<?xml version="1.0"?>
+<nmaprun scanner="nmap" version="7.94" args="nmap -oX - 10.0.0.0/30" start="1700000000" xmloutputversion="1.05">
+	<scaninfo type="syn" protocol="tcp" numservices="1" services="22"/>
+	<verbose level="0"/>
+	<debugging level="0"/>
+	<taskbegin task="SYN Stealth Scan" time="1700000001"/>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.0.1" addrtype="ipv4"/>
+		<ports><port protocol="tcp" portid="22"><state state="open"/></port></ports>
+	</host>
+	<taskend task="SYN Stealth Scan" time="1700000002"/>
+	<host>
+		<status state="up"/>
+		<address addr="10.0.0.2" addrtype="ipv4"/>
+	</host>
+	<postscript><script id="summary" output="done"/></postscript>
+	<runstats>
+		<finished time="1700000010" elapsed="10.00" exit="success"/>
+		<hosts up="2" down="2" total="4"/>
+	</runstats>
+</nmaprun>`
+
+func TestParseNmapStream(t *testing.T) {
+	var hosts []string
+	nmapRun, err := parseNmapStream(strings.NewReader(streamXML), func(host NmapHost) {
+		hosts = append(hosts, hostIdentity(host))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(hosts) != 2 || hosts[0] != "10.0.0.1" || hosts[1] != "10.0.0.2" {
+		t.Errorf("expected callbacks for 10.0.0.1 and 10.0.0.2, got %v", hosts)
+	}
+	if len(nmapRun.Hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(nmapRun.Hosts))
+	}
+	if len(nmapRun.Hosts[0].Ports) != 1 || nmapRun.Hosts[0].Ports[0].PortID != 22 {
+		t.Errorf("expected port 22 on first host, got %+v", nmapRun.Hosts[0].Ports)
+	}
+	if nmapRun.Version != "7.94" || nmapRun.Start != "1700000000" || nmapRun.XMLOutputVersion != "1.05" {
+		t.Errorf("unexpected run attributes: %+v", nmapRun)
+	}
+	if len(nmapRun.ScanInfo) != 1 || nmapRun.ScanInfo[0].Type != "syn" {
+		t.Errorf("unexpected scaninfo: %+v", nmapRun.ScanInfo)
+	}
+	if len(nmapRun.PostScripts) != 1 || nmapRun.PostScripts[0].ID != "summary" {
+		t.Errorf("unexpected postscripts: %+v", nmapRun.PostScripts)
+	}
+	if nmapRun.RunStats.Finished.Exit != "success" || nmapRun.RunStats.Hosts.Total != "4" {
+		t.Errorf("unexpected runstats: %+v", nmapRun.RunStats)
+	}
+}
+
+func TestParseNmapStreamMatchesParseNmapRun(t *testing.T) {
+	streamed, err := parseNmapStream(strings.NewReader(streamXML), nil)
+	if err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	buffered, err := parseNmapRun([]byte(streamXML))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	a := convertToProtoResponse(streamed, nil, nil, 1, time.Unix(0, 0))
+	b := convertToProtoResponse(buffered, nil, nil, 1, time.Unix(0, 0))
+	if len(a.Hosts) != len(b.Hosts) || a.HostsUp != b.HostsUp || a.TotalHosts != b.TotalHosts || a.NmapVersion != b.NmapVersion {
+		t.Errorf("streamed and buffered parses differ: %+v vs %+v", a, b)
+	}
+}
+
+func TestParseNmapStreamEmitsHostsEarly(t *testing.T) {
+	r, w := io.Pipe()
+	seen := make(chan string, 1)
+
+	type result struct {
+		run *NmapRun
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		run, err := parseNmapStream(r, func(host NmapHost) {
+			seen <- hostIdentity(host)
+		})
+		done <- result{run, err}
+	}()
+
+	io.WriteString(w, `<nmaprun><host><status state="up"/><address addr="10.0.0.1" addrtype="ipv4"/></host>`)
+
+	// The host must be reported while the document is still open
+	select {
+	case ip := <-seen:
+		if ip != "10.0.0.1" {
+			t.Errorf("expected 10.0.0.1, got %s", ip)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("host was not emitted before the document completed")
+	}
+
+	io.WriteString(w, `<runstats><finished exit="success"/></runstats></nmaprun>`)
+	w.Close()
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("unexpected error: %v", res.err)
+	}
+	if len(res.run.Hosts) != 1 {
+		t.Errorf("expected 1 host, got %d", len(res.run.Hosts))
+	}
+}
+
+func TestParseNmapStreamTaskEvents(t *testing.T) {
+	data := `<nmaprun>
+<taskbegin task="SYN Stealth Scan" time="1700000000"/>
+<taskprogress task="SYN Stealth Scan" time="1700000005" percent="42.50" remaining="7" etc="1700000012"/>
+<taskend task="SYN Stealth Scan" time="1700000012" extrainfo="1000 total ports"/>
+<host><status state="up"/><address addr="10.0.0.1" addrtype="ipv4"/></host>
+</nmaprun>`
+
+	var events []NmapTaskEvent
+	run, err := parseNmapStreamEvents(strings.NewReader(data), nil, func(event NmapTaskEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(run.Hosts) != 1 {
+		t.Errorf("expected 1 host, got %d", len(run.Hosts))
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 task events, got %d", len(events))
+	}
+
+	progress := events[1]
+	if progress.XMLName.Local != "taskprogress" || progress.Task != "SYN Stealth Scan" ||
+		progress.Percent != 42.5 || progress.Remaining != 7 || progress.Etc != 1700000012 {
+		t.Errorf("unexpected taskprogress event: %+v", progress)
+	}
+	if events[2].ExtraInfo != "1000 total ports" {
+		t.Errorf("unexpected taskend extrainfo: %q", events[2].ExtraInfo)
+	}
+}
+
+func TestParseNmapStreamTruncated(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		wantErr       bool
+		wantTruncated bool
+		wantHosts     int
+	}{
+		{
+			name:    "empty input",
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:    "not nmap XML",
+			input:   "this is not valid XML",
+			wantErr: true,
+		},
+		{
+			name:    "wrong root element",
+			input:   `<scan><host><address addr="10.0.0.1" addrtype="ipv4"/></host></scan>`,
+			wantErr: true,
+		},
+		{
+			name:          "cut off inside the first host",
+			input:         `<nmaprun><host><status`,
+			wantTruncated: true,
+			wantHosts:     0,
+		},
+		{
+			name:          "cut off after a complete host",
+			input:         `<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/></host><host><status`,
+			wantTruncated: true,
+			wantHosts:     1,
+		},
+		{
+			name:          "missing closing nmaprun",
+			input:         `<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/></host><host><address addr="10.0.0.2" addrtype="ipv4"/></host>`,
+			wantTruncated: true,
+			wantHosts:     2,
+		},
+		{
+			name:          "garbage after a complete host",
+			input:         `<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/></host><<<`,
+			wantTruncated: true,
+			wantHosts:     1,
+		},
+		{
+			name:      "complete document",
+			input:     `<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/></host></nmaprun>`,
+			wantHosts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nmapRun, err := parseNmapRun([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if nmapRun.Truncated != tt.wantTruncated {
+				t.Errorf("expected truncated=%v, got %v", tt.wantTruncated, nmapRun.Truncated)
+			}
+			if len(nmapRun.Hosts) != tt.wantHosts {
+				t.Errorf("expected %d hosts, got %d", tt.wantHosts, len(nmapRun.Hosts))
+			}
+		})
+	}
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	// Interrupted scan: two hosts finished, the third was cut off and runstats never written
+	truncated := streamXML[:strings.Index(streamXML, "<postscript>")] + `<host><status state="up"/><address addr="10.0.0.3"`
+
+	nmapRun, err := parseNmapRun([]byte(truncated))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	response := convertToProtoResponse(nmapRun, buildDiscoveryResult(nmapRun), nil, 5, time.Now())
+	if !response.Truncated {
+		t.Error("expected response to be flagged as truncated")
+	}
+	if response.CompleteHosts != 2 || len(response.Hosts) != 2 {
+		t.Errorf("expected 2 complete hosts, got %d (%d in response)", response.CompleteHosts, len(response.Hosts))
+	}
+	if response.ScanDuration != 5 {
+		t.Errorf("expected local scan duration without runstats, got %f", response.ScanDuration)
+	}
+	if len(response.Discovery.Hosts) != 2 {
+		t.Errorf("expected 2 discovered hosts, got %d", len(response.Discovery.Hosts))
+	}
+
+	complete, err := parseNmapRun([]byte(streamXML))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response = convertToProtoResponse(complete, nil, nil, 5, time.Now())
+	if response.Truncated || response.CompleteHosts != 2 {
+		t.Errorf("expected complete document not truncated with 2 hosts, got truncated=%v hosts=%d", response.Truncated, response.CompleteHosts)
+	}
+}